@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go_server/m/common/errinfo"
+	"go_server/m/common/httprec"
+	"go_server/m/logging"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/google/uuid"
+)
+
+//go:embed openapi.yml
+var specData []byte
+
+func init() {
+	openapi3.DefineStringFormatCallback("uuid", func(s string) error {
+		_, err := uuid.Parse(s)
+		return err
+	})
+}
+
+func LoadSpec() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(specData)
+	if err != nil {
+		return nil, err
+	}
+	if err = doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+var (
+	schemasOnce sync.Once
+	schemas     openapi3.Schemas
+	schemasErr  error
+)
+
+// ValidateSchema checks a decoded JSON value against a component schema of
+// the spec. It is meant for payloads the middleware does not see one by one,
+// e.g. rows of a bulk import.
+func ValidateSchema(name string, value interface{}) ([]errinfo.FieldError, error) {
+	schemasOnce.Do(func() {
+		doc, err := LoadSpec()
+		if err != nil {
+			schemasErr = err
+			return
+		}
+		schemas = doc.Components.Schemas
+	})
+	if schemasErr != nil {
+		return nil, schemasErr
+	}
+	schema, ok := schemas[name]
+	if !ok || schema.Value == nil {
+		return nil, errors.New("unknown schema " + name)
+	}
+	err := schema.Value.VisitJSON(value, openapi3.MultiErrors())
+	if err == nil {
+		return nil, nil
+	}
+	var fields []errinfo.FieldError
+	for _, schema_err := range schemaErrors(err) {
+		fields = append(fields, errinfo.FieldError{Field: strings.Join(schema_err.JSONPointer(), "."), Message: schema_err.Reason})
+	}
+	if len(fields) == 0 {
+		fields = append(fields, errinfo.FieldError{Message: err.Error()})
+	}
+	return fields, nil
+}
+
+// Validator checks requests, and in test mode responses, against the
+// embedded OpenAPI document. Routes missing from the document are passed
+// through unchecked. Multipart uploads and file downloads are streamed, so
+// only their parameters and statuses are checked.
+type Validator struct {
+	router            routers.Router
+	validateResponses bool
+}
+
+func NewValidator(validate_responses bool) (*Validator, error) {
+	doc, err := LoadSpec()
+	if err != nil {
+		return nil, err
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{router: router, validateResponses: validate_responses}, nil
+}
+
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, path_params, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		request_input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: path_params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				ExcludeRequestBody: isMultipart(r.Header.Get("Content-Type")),
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), request_input); err != nil {
+			errinfo.SendHttpErr(w, requestErrToErrInfo(err))
+			return
+		}
+
+		if !v.validateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+		recorder := httprec.New(w.Header())
+		next.ServeHTTP(recorder, r)
+		response_input := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: request_input,
+			Status:                 recorder.Status,
+			Header:                 recorder.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(recorder.Bytes())),
+			Options: &openapi3filter.Options{
+				IncludeResponseStatus: true,
+				ExcludeResponseBody:   isDownload(recorder.Header()),
+			},
+		}
+		if err := openapi3filter.ValidateResponse(r.Context(), response_input); err != nil {
+			logging.FromRequest(r).Error("response does not match the spec", "err", err)
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeResponseInvalid).WithField("response", err.Error()))
+			return
+		}
+		recorder.Send(w)
+	})
+}
+
+func isMultipart(content_type string) bool {
+	media_type, _, _ := mime.ParseMediaType(content_type)
+	return media_type == "multipart/form-data"
+}
+
+func isDownload(header http.Header) bool {
+	disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	return disposition == "attachment"
+}
+
+func requestErrToErrInfo(err error) errinfo.ErrorInfo {
+	err_info := errinfo.New(errinfo.CodeValidationFailed)
+	var errs openapi3.MultiError
+	if !errors.As(err, &errs) {
+		errs = openapi3.MultiError{err}
+	}
+	for _, err := range errs {
+		var request_err *openapi3filter.RequestError
+		if !errors.As(err, &request_err) {
+			err_info = err_info.WithField("", err.Error())
+			continue
+		}
+		field := ""
+		if request_err.Parameter != nil {
+			field = request_err.Parameter.Name
+		}
+		schema_errs := schemaErrors(request_err.Err)
+		if len(schema_errs) == 0 {
+			err_info = err_info.WithField(field, request_err.Error())
+			continue
+		}
+		for _, schema_err := range schema_errs {
+			name := field
+			if pointer := schema_err.JSONPointer(); len(pointer) != 0 {
+				name = strings.Join(pointer, ".")
+			}
+			err_info = err_info.WithField(name, schema_err.Reason)
+		}
+	}
+	return err_info
+}
+
+func schemaErrors(err error) (result []*openapi3.SchemaError) {
+	var errs openapi3.MultiError
+	if errors.As(err, &errs) {
+		for _, err := range errs {
+			result = append(result, schemaErrors(err)...)
+		}
+		return
+	}
+	var schema_err *openapi3.SchemaError
+	if errors.As(err, &schema_err) {
+		result = append(result, schema_err)
+	}
+	return
+}
@@ -0,0 +1,331 @@
+package attachments
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go_server/m/audit"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/logging"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// multipartOverhead is allowed on top of the file size for the part
+// headers and boundaries.
+const multipartOverhead = 64 << 10
+
+// allowedTypes maps a declared content type to the types
+// http.DetectContentType may report for it. Office documents are zip files.
+var allowedTypes = map[string][]string{
+	"application/pdf": {"application/pdf"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       {"application/zip"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": {"application/zip"},
+	"text/csv":   {"text/plain"},
+	"image/png":  {"image/png"},
+	"image/jpeg": {"image/jpeg"},
+}
+
+type Attachment struct {
+	ID            uuid.UUID `json:"id"`
+	EntityType    string    `json:"entity_type"`
+	EntityID      uuid.UUID `json:"entity_id"`
+	EntityVersion int       `json:"version"`
+	FileName      string    `json:"file_name"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	StorageKey    string    `json:"-"`
+	UploadedBy    int       `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Attachments serves uploads and downloads of files kept in a BlobStore.
+type Attachments struct {
+	db       *sql.DB
+	store    BlobStore
+	max_size int64
+}
+
+func NewAttachments(db *sql.DB, store BlobStore, max_size int64) *Attachments {
+	return &Attachments{db: db, store: store, max_size: max_size}
+}
+
+const attachmentColumns = `id, entity_type, entity_id, entity_version, file_name, content_type, size, sha256, storage_key, uploaded_by, created_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAttachment(row scanner) (attachment Attachment, err error) {
+	err = row.Scan(&attachment.ID, &attachment.EntityType, &attachment.EntityID, &attachment.EntityVersion,
+		&attachment.FileName, &attachment.ContentType, &attachment.Size, &attachment.SHA256,
+		&attachment.StorageKey, &attachment.UploadedBy, &attachment.CreatedAt)
+	return
+}
+
+func createAttachment(ctx context.Context, db dbhelp.Querier, attachment *Attachment) errinfo.ErrorInfo {
+	query := `
+		INSERT INTO attachments (id, entity_type, entity_id, entity_version, file_name, content_type, size, sha256, storage_key, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at`
+	err := db.QueryRowContext(ctx, query, attachment.ID, attachment.EntityType, attachment.EntityID, attachment.EntityVersion,
+		attachment.FileName, attachment.ContentType, attachment.Size, attachment.SHA256,
+		attachment.StorageKey, attachment.UploadedBy).Scan(&attachment.CreatedAt)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+}
+
+func getAttachment(ctx context.Context, db *sql.DB, e entity, attachment_id uuid.UUID) (*Attachment, errinfo.ErrorInfo) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = $1 AND entity_type = $2 AND entity_id = $3`
+	attachment, err := scanAttachment(db.QueryRowContext(ctx, query, attachment_id, e.Type, e.ID))
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeAttachmentNotFound)
+	}
+	return &attachment, errinfo.Ok()
+}
+
+// getAttachments lists the attachments of every version of the entity, or
+// of one version if version is positive.
+func getAttachments(ctx context.Context, db *sql.DB, e entity, version, limit, offset int) ([]Attachment, errinfo.ErrorInfo) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments
+		WHERE entity_type = $1 AND entity_id = $2 AND ($3 = 0 OR entity_version = $3)
+		ORDER BY entity_version, created_at
+		LIMIT $4
+		OFFSET $5
+	`
+	rows, err := db.QueryContext(ctx, query, e.Type, e.ID, version, limit, offset)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+
+	result := []Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		result = append(result, attachment)
+	}
+	return result, dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
+}
+
+// isAllowedType checks the declared type against the allow list and against
+// what the first bytes of the file look like.
+func isAllowedType(declared string, head []byte) bool {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	for _, allowed := range allowedTypes[declared] {
+		if sniffed == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+type countWriter int64
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
+
+// receive streams the "file" part of the multipart body into the blob store,
+// hashing it on the way, without holding the whole file in memory. The
+// caller records the attachment, or deletes the blob if it can't.
+func (a *Attachments) receive(r *http.Request, e entity) (attachment *Attachment, err_info errinfo.ErrorInfo) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		err_info = errinfo.New(errinfo.CodeWrongRequest)
+		return
+	}
+	var part io.Reader
+	var file_name, header_type string
+	for {
+		next, err := reader.NextPart()
+		if err == io.EOF {
+			err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("file", "Required.")
+			return
+		}
+		if err != nil {
+			err_info = errinfo.New(errinfo.CodeWrongRequest)
+			return
+		}
+		if next.FormName() == "file" {
+			part, file_name, header_type = next, next.FileName(), next.Header.Get("Content-Type")
+			break
+		}
+	}
+	file_name = filepath.Base(filepath.FromSlash(file_name))
+	if file_name == "." || file_name == string(filepath.Separator) || utf8.RuneCountInString(file_name) > 255 {
+		err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("file", "File name must be from 1 to 255 characters.")
+		return
+	}
+
+	buffered := bufio.NewReader(part)
+	head, _ := buffered.Peek(512)
+	if len(head) == 0 {
+		err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("file", "Must not be empty.")
+		return
+	}
+	content_type, _, _ := mime.ParseMediaType(header_type)
+	if !isAllowedType(content_type, head) {
+		err_info = errinfo.New(errinfo.CodeAttachmentType)
+		return
+	}
+
+	attachment = &Attachment{
+		ID:            uuid.New(),
+		EntityType:    e.Type,
+		EntityID:      e.ID,
+		EntityVersion: e.Version,
+		FileName:      file_name,
+		ContentType:   content_type,
+		UploadedBy:    e.UserID,
+	}
+	attachment.StorageKey = e.Type + "/" + e.ID.String() + "/" + attachment.ID.String()
+
+	hash := sha256.New()
+	var size countWriter
+	body := io.TeeReader(io.LimitReader(buffered, a.max_size+1), io.MultiWriter(hash, &size))
+	err = a.store.Put(r.Context(), attachment.StorageKey, body, content_type)
+	var max_bytes_err *http.MaxBytesError
+	if errors.As(err, &max_bytes_err) || int64(size) > a.max_size {
+		a.store.Delete(r.Context(), attachment.StorageKey)
+		err_info = errinfo.New(errinfo.CodeAttachmentTooLarge)
+		return
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("attachments: can't store", "key", attachment.StorageKey, "err", err)
+		err_info = errinfo.New(errinfo.CodeServer)
+		return
+	}
+	attachment.Size = int64(size)
+	attachment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return
+}
+
+// UploadHandler stores the multipart "file" field as an attachment of the
+// current entity version.
+func (a *Attachments) UploadHandler(resolve Resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, err_info := resolve(a.db, r, true)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, a.max_size+multipartOverhead)
+		attachment, err_info := a.receive(r, e)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		action := audit.ActionTenderAttach
+		if e.Type == audit.EntityBid {
+			action = audit.ActionBidAttach
+		}
+		err_info = dbhelp.InTxInfo(r.Context(), a.db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := createAttachment(r.Context(), tx, attachment); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          r.URL.Query().Get("username"),
+				OrganizationID: e.OrganizationID,
+				EntityType:     e.Type,
+				EntityID:       e.ID.String(),
+				Action:         action,
+				After:          attachment,
+			})
+		})
+		if err_info.Status != 200 {
+			a.store.Delete(r.Context(), attachment.StorageKey)
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(attachment)
+	}
+}
+
+func (a *Attachments) ListHandler(resolve Resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		version := 0
+		if s_version := r.URL.Query().Get("version"); s_version != "" {
+			if version, err_info = helpers.Atoi(s_version); err_info.Status != 200 {
+				errinfo.SendHttpErr(w, err_info)
+				return
+			}
+		}
+		e, err_info := resolve(a.db, r, false)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		result, err_info := getAttachments(r.Context(), a.db, e, version, limit, offset)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// DownloadHandler streams the attachment with its checksum in Repr-Digest.
+func (a *Attachments) DownloadHandler(resolve Resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		attachment_id, err_info := helpers.ParseUUID(mux.Vars(r)["attachmentId"])
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		e, err_info := resolve(a.db, r, false)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		attachment, err_info := getAttachment(r.Context(), a.db, e, attachment_id)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		blob, err := a.store.Get(r.Context(), attachment.StorageKey)
+		if err != nil {
+			logging.FromRequest(r).Error("attachments: can't read", "key", attachment.StorageKey, "err", err)
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeServer))
+			return
+		}
+		defer blob.Close()
+
+		checksum, _ := hex.DecodeString(attachment.SHA256)
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+		w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(checksum)+":")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		io.Copy(w, blob)
+	}
+}
@@ -0,0 +1,90 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// An S3-compatible store, e.g. s3://minioadmin:minioadmin@localhost:9000/attachments-test?secure=false,
+// is only exercised when given.
+const testS3Env = "TEST_S3_URL"
+
+func testStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	key := fmt.Sprintf("tender/test/%d", time.Now().UnixNano())
+	if err := store.Put(ctx, key, strings.NewReader("contents"), "text/csv"); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil || string(data) != "contents" {
+		t.Errorf("got %q, %v", data, err)
+	}
+	if err = store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("deleted blob: %v", err)
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	store, err := NewBlobStore(context.Background(), "file:"+t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+	for _, key := range []string{"", "../outside", "/etc/passwd"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), "text/csv"); err == nil {
+			t.Errorf("key %q accepted", key)
+		}
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	store_url := os.Getenv(testS3Env)
+	if store_url == "" {
+		t.Skip(testS3Env + " is not set")
+	}
+	u, err := url.Parse(store_url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewS3StoreFromURL(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func TestIsAllowedType(t *testing.T) {
+	cases := []struct {
+		declared string
+		content  string
+		want     bool
+	}{
+		{"application/pdf", "%PDF-1.7\n", true},
+		{"application/pdf", "hello", false},
+		{"text/csv", "name,price\nbox,10\n", true},
+		{"text/csv", "%PDF-1.7\n", false},
+		{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "PK\x03\x04rest", true},
+		{"image/png", "\x89PNG\x0D\x0A\x1A\x0A", true},
+		{"application/x-msdownload", "MZ", false},
+	}
+	for _, c := range cases {
+		if got := isAllowedType(c.declared, []byte(c.content)); got != c.want {
+			t.Errorf("isAllowedType(%q, %q) = %v", c.declared, c.content, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// ErrBlobNotFound is returned by BlobStore.Get for an unknown key.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps attachment contents. Keys are slash separated paths
+// chosen by the server, never by clients.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, content_type string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewBlobStore opens the store given by BLOB_STORE_URL:
+//
+//	file:data/attachments or file:///var/lib/tenders
+//	s3://access_key:secret_key@minio:9000/bucket?secure=false
+func NewBlobStore(ctx context.Context, store_url string) (BlobStore, error) {
+	u, err := url.Parse(store_url)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		root := u.Path
+		if root == "" {
+			root = u.Opaque
+		}
+		return NewFSStore(root)
+	case "s3":
+		return NewS3StoreFromURL(ctx, u)
+	}
+	return nil, fmt.Errorf("unsupported blob store scheme %q", u.Scheme)
+}
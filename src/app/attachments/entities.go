@@ -0,0 +1,98 @@
+package attachments
+
+import (
+	"database/sql"
+	"net/http"
+
+	"go_server/m/audit"
+	"go_server/m/bids"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/tenders"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// entity is the tender or bid version an attachment belongs to.
+type entity struct {
+	Type           string
+	ID             uuid.UUID
+	Version        int
+	OrganizationID int
+	UserID         int
+}
+
+// Resolver loads the entity of the request and checks that the user may
+// read its attachments, or add them if write is set.
+type Resolver func(db *sql.DB, r *http.Request, write bool) (entity, errinfo.ErrorInfo)
+
+// TenderEntity lets the organizations of the tender with tenders.RightEdit
+// attach files. Others who see the tender may read them once it is
+// published.
+func TenderEntity(db *sql.DB, r *http.Request, write bool) (result entity, err_info errinfo.ErrorInfo) {
+	tender_id, err_info := helpers.ParseUUID(mux.Vars(r)["tenderId"])
+	if err_info.Status != 200 {
+		return
+	}
+	access, err_info := tenders.GetAccess(r.Context(), db, r.URL.Query().Get("username"), tender_id)
+	if err_info.Status == 200 && write {
+		err_info = access.Allow(tenders.RightEdit)
+	} else if err_info.Status == 200 {
+		err_info = access.Err()
+	}
+	if err_info.Status != 200 && err_info.Code != errinfo.CodeNoPermission {
+		return
+	}
+	tender := access.Tender
+	result = entity{Type: audit.EntityTender, ID: tender.ID, Version: tender.Version,
+		OrganizationID: tender.OrganizationID, UserID: access.UserID}
+	if err_info.Status != 200 && !write && tender.Status == "Published" {
+		err_info = access.VisibleErr()
+	}
+	return
+}
+
+// BidEntity lets the bid author attach files while the tender is open.
+// The author and the organizations of the tender may read them.
+func BidEntity(db *sql.DB, r *http.Request, write bool) (result entity, err_info errinfo.ErrorInfo) {
+	bid_id, err_info := helpers.ParseUUID(mux.Vars(r)["bidId"])
+	if err_info.Status != 200 {
+		return
+	}
+	user_id, err_info := dbhelp.GetUserId(r.Context(), db, r.URL.Query().Get("username"))
+	if err_info.Status != 200 {
+		return
+	}
+	bid, err_info := bids.GetBid(r.Context(), db, bid_id)
+	if err_info.Status != 200 {
+		return
+	}
+	tender, err_info := tenders.GetTender(r.Context(), db, bid.TenderID)
+	if err_info.Status != 200 {
+		return
+	}
+	result = entity{Type: audit.EntityBid, ID: bid.ID, Version: bid.Version,
+		OrganizationID: tender.OrganizationID, UserID: user_id}
+	is_author, err_info := bids.IsBidAuthor(r.Context(), db, bid, user_id)
+	if err_info.Status != 200 {
+		return
+	}
+	if write {
+		if !is_author {
+			err_info = errinfo.New(errinfo.CodeNotBidAuthor)
+		} else if tender.Status == "Closed" {
+			err_info = errinfo.New(errinfo.CodeTenderClosed)
+		}
+		return
+	}
+	if !is_author {
+		var access *tenders.Access
+		access, err_info = tenders.GetAccessByUserId(r.Context(), db, user_id, tender.ID)
+		if err_info.Status == 200 {
+			err_info = access.Err()
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FSStore keeps blobs as files under a root directory. Put writes to a
+// temporary file first, so readers never see a partial blob.
+type FSStore struct {
+	root string
+}
+
+func NewFSStore(root string) (*FSStore, error) {
+	if root == "" {
+		return nil, errors.New("blob store root is empty")
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+	return &FSStore{root: root}, nil
+}
+
+func (s *FSStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.root, clean), nil
+}
+
+func (s *FSStore) Put(ctx context.Context, key string, r io.Reader, content_type string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return file, err
+}
+
+func (s *FSStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
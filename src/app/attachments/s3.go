@@ -0,0 +1,80 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store keeps blobs in a bucket of any S3-compatible service, e.g. MinIO.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Store(client *minio.Client, bucket string) *S3Store {
+	return &S3Store{client: client, bucket: bucket}
+}
+
+// NewS3StoreFromURL connects to s3://access_key:secret_key@host/bucket and
+// creates the bucket if it is missing. TLS is used unless ?secure=false.
+func NewS3StoreFromURL(ctx context.Context, u *url.URL) (*S3Store, error) {
+	bucket := strings.Trim(u.Path, "/")
+	if u.Host == "" || bucket == "" {
+		return nil, errors.New("blob store URL needs a host and a bucket")
+	}
+	secret_key, _ := u.User.Password()
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(u.User.Username(), secret_key, ""),
+		Secure: u.Query().Get("secure") != "false",
+		Region: u.Query().Get("region"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: u.Query().Get("region")}); err != nil {
+			return nil, err
+		}
+	}
+	return NewS3Store(client, bucket), nil
+}
+
+// s3PartSize is the smallest multipart part S3 accepts. The size of an upload
+// is unknown while it streams, and without a part size minio-go would buffer
+// parts sized for a 5 TiB object.
+const s3PartSize = 5 << 20
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, content_type string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, -1, minio.PutObjectOptions{ContentType: content_type, PartSize: s3PartSize})
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, Stat surfaces a missing key before the download starts.
+	if _, err = object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,174 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/requestid"
+	"go_server/m/logging"
+)
+
+const (
+	EntityTender        = "tender"
+	EntityBid           = "bid"
+	EntityQualification = "qualification"
+	EntityOrganization  = "organization"
+	EntityEmployee      = "employee"
+)
+
+const (
+	ActionTenderCreate         = "tender.create"
+	ActionTenderStatus         = "tender.status"
+	ActionTenderEdit           = "tender.edit"
+	ActionTenderRollback       = "tender.rollback"
+	ActionTenderQuestion       = "tender.question"
+	ActionTenderAnswer         = "tender.answer"
+	ActionTenderAttach         = "tender.attach"
+	ActionTenderOwner          = "tender.owner"
+	ActionTenderInvitation     = "tender.invitation"
+	ActionBidCreate            = "bid.create"
+	ActionBidStatus            = "bid.status"
+	ActionBidEdit              = "bid.edit"
+	ActionBidRollback          = "bid.rollback"
+	ActionBidFeedback          = "bid.feedback"
+	ActionBidDecision          = "bid.decision"
+	ActionBidWithdraw          = "bid.withdraw"
+	ActionBidResubmit          = "bid.resubmit"
+	ActionBidAttach            = "bid.attach"
+	ActionQualificationRequest = "qualification.request"
+	ActionQualificationReview  = "qualification.review"
+	ActionOrganizationMember   = "organization.member"
+	ActionEmployeeCreate       = "employee.create"
+)
+
+// GenesisHash is the prev_hash of the first entry in the chain.
+var GenesisHash = strings.Repeat("0", 64)
+
+type Entry struct {
+	ID             int64           `json:"id"`
+	Actor          string          `json:"actor"`
+	OrganizationID int             `json:"organizationId"`
+	EntityType     string          `json:"entityType"`
+	EntityID       string          `json:"entityId"`
+	Action         string          `json:"action"`
+	Before         json.RawMessage `json:"before,omitempty"`
+	After          json.RawMessage `json:"after,omitempty"`
+	RequestID      string          `json:"requestId,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	PrevHash       string          `json:"prevHash"`
+	Hash           string          `json:"hash"`
+}
+
+// Event describes a mutation. Before and After are marshalled to JSON as is,
+// nil means the state does not exist (e.g. Before of a created entity).
+type Event struct {
+	Actor          string
+	OrganizationID int
+	EntityType     string
+	EntityID       string
+	Action         string
+	Before         interface{}
+	After          interface{}
+}
+
+func marshalState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+func nullableJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+func (entry *Entry) computeHash() string {
+	h := sha256.New()
+	fields := []string{
+		entry.PrevHash,
+		entry.Actor,
+		strconv.Itoa(entry.OrganizationID),
+		entry.EntityType,
+		entry.EntityID,
+		entry.Action,
+		string(entry.Before),
+		string(entry.After),
+		entry.RequestID,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// appendEntry chains the entry to the latest one. The chain lock is held
+// until tx ends, so entries are chained in commit order.
+func appendEntry(ctx context.Context, tx *sql.Tx, entry *Entry) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, dbhelp.LockAuditChain); err != nil {
+		return err
+	}
+	err := tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&entry.PrevHash)
+	if err == sql.ErrNoRows {
+		entry.PrevHash = GenesisHash
+	} else if err != nil {
+		return err
+	}
+	entry.Hash = entry.computeHash()
+
+	query := `
+		INSERT INTO audit_log (actor, organization_id, entity_type, entity_id, action,
+			before_data, after_data, request_id, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id`
+	return tx.QueryRowContext(ctx, query, entry.Actor, entry.OrganizationID, entry.EntityType, entry.EntityID, entry.Action,
+		nullableJSON(entry.Before), nullableJSON(entry.After), entry.RequestID, entry.CreatedAt,
+		entry.PrevHash, entry.Hash).Scan(&entry.ID)
+}
+
+// Record appends the event to the audit log in tx, the transaction of the
+// mutation, so that the change and its entry commit together or not at all.
+// The event actor also becomes the actor of the access log line.
+func Record(tx *sql.Tx, r *http.Request, event Event) errinfo.ErrorInfo {
+	logging.SetActor(r.Context(), event.Actor)
+	return Append(r.Context(), tx, requestid.FromRequest(r), event)
+}
+
+// Append is Record outside of an HTTP request, e.g. in the CLI.
+func Append(ctx context.Context, tx *sql.Tx, request_id string, event Event) errinfo.ErrorInfo {
+	entry := Entry{
+		Actor:          event.Actor,
+		OrganizationID: event.OrganizationID,
+		EntityType:     event.EntityType,
+		EntityID:       event.EntityID,
+		Action:         event.Action,
+		RequestID:      request_id,
+		// Postgres keeps microseconds, the hash must survive the round trip.
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	var err error
+	if entry.Before, err = marshalState(event.Before); err == nil {
+		entry.After, err = marshalState(event.After)
+	}
+	if err == nil {
+		err = appendEntry(ctx, tx, &entry)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("audit: can't record", "action", event.Action, "entity_id", event.EntityID, "err", err)
+		return errinfo.New(errinfo.CodeServer)
+	}
+	return errinfo.Ok()
+}
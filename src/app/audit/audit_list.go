@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+)
+
+type Filter struct {
+	EntityType string
+	EntityID   string
+	Actor      string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+const entryColumns = `id, actor, organization_id, entity_type, entity_id, action,
+	before_data, after_data, request_id, created_at, prev_hash, hash`
+
+func scanEntry(rows *sql.Rows) (entry Entry, err error) {
+	var before, after, request_id sql.NullString
+	var organization_id sql.NullInt64
+	err = rows.Scan(&entry.ID, &entry.Actor, &organization_id, &entry.EntityType, &entry.EntityID, &entry.Action,
+		&before, &after, &request_id, &entry.CreatedAt, &entry.PrevHash, &entry.Hash)
+	if err != nil {
+		return
+	}
+	entry.OrganizationID = int(organization_id.Int64)
+	entry.RequestID = request_id.String
+	if before.Valid {
+		entry.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		entry.After = json.RawMessage(after.String)
+	}
+	return
+}
+
+// getEntries returns entries of organizations the user is responsible for.
+func getEntries(ctx context.Context, db *sql.DB, user_id int, filter *Filter) ([]Entry, errinfo.ErrorInfo) {
+	conditions := []string{`organization_id IN (SELECT organization_id FROM organization_responsible WHERE user_id = $1)`}
+	args := []interface{}{user_id}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+	if filter.EntityType != "" {
+		addCondition("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		addCondition("entity_id = ?", filter.EntityID)
+	}
+	if filter.Actor != "" {
+		addCondition("actor = ?", filter.Actor)
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= ?", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < ?", filter.To.UTC())
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query := `SELECT ` + entryColumns + `
+		FROM audit_log
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY id
+		LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	err_info := dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+			return nil, err_info
+		}
+		entries = append(entries, entry)
+	}
+	err_info = dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
+	return entries, err_info
+}
+
+func parseTime(name, s string) (t time.Time, err_info errinfo.ErrorInfo) {
+	err_info = errinfo.Ok()
+	if s == "" {
+		return
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		err_info = errinfo.New(errinfo.CodeInvalidTime).WithField(name, errinfo.ErrMessageInvalidTime)
+	}
+	return
+}
+
+func getFilterFromRequest(r *http.Request) (filter Filter, err_info errinfo.ErrorInfo) {
+	query := r.URL.Query()
+	filter.EntityType = query.Get("entityType")
+	filter.EntityID = query.Get("entityId")
+	filter.Actor = query.Get("actor")
+	filter.Limit, filter.Offset, err_info = helpers.GetLimitOffsetFromRequest(r)
+	if err_info.Status != 200 {
+		return
+	}
+	if filter.From, err_info = parseTime("from", query.Get("from")); err_info.Status != 200 {
+		return
+	}
+	filter.To, err_info = parseTime("to", query.Get("to"))
+	return
+}
+
+func AuditHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err_info := getFilterFromRequest(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_id, err_info := dbhelp.GetUserId(r.Context(), db, dbhelp.GetUserNameFromRequest(r))
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		entries, err_info := getEntries(r.Context(), db, user_id, &filter)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
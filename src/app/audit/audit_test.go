@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testChain returns entries chained as appendEntry chains them.
+func testChain(n int) []Entry {
+	entries := make([]Entry, n)
+	prev_hash := GenesisHash
+	for i := range entries {
+		entry := &entries[i]
+		*entry = Entry{ID: int64(i + 1), Actor: "user1", OrganizationID: 1, EntityType: EntityTender,
+			EntityID: "tender", Action: ActionTenderEdit, After: json.RawMessage(`{"version":` + strconv.Itoa(i+1) + `}`),
+			CreatedAt: time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC), PrevHash: prev_hash}
+		entry.Hash = entry.computeHash()
+		prev_hash = entry.Hash
+	}
+	return entries
+}
+
+func verifyEntries(entries []Entry) VerifyResult {
+	verifier := newChainVerifier()
+	for i := range entries {
+		if !verifier.check(&entries[i]) {
+			return verifier.result
+		}
+	}
+	verifier.result.Valid = true
+	return verifier.result
+}
+
+func TestVerifyChain(t *testing.T) {
+	if result := verifyEntries(testChain(3)); !result.Valid || result.Checked != 3 {
+		t.Errorf("intact chain: %+v", result)
+	}
+
+	changed := testChain(3)
+	changed[1].After = json.RawMessage(`{"version":9}`)
+	if result := verifyEntries(changed); result.Valid || result.BrokenID != 2 || result.Checked != 1 {
+		t.Errorf("changed entry: %+v", result)
+	}
+
+	rehashed := testChain(3)
+	rehashed[1].Actor = "user2"
+	rehashed[1].Hash = rehashed[1].computeHash()
+	if result := verifyEntries(rehashed); result.Valid || result.BrokenID != 3 {
+		t.Errorf("changed and rehashed entry: %+v", result)
+	}
+
+	removed := testChain(3)
+	removed = append(removed[:1], removed[2])
+	if result := verifyEntries(removed); result.Valid || result.BrokenID != 3 {
+		t.Errorf("removed entry: %+v", result)
+	}
+
+	if result := verifyEntries(testChain(3)[1:]); result.Valid || result.BrokenID != 2 {
+		t.Errorf("removed first entry: %+v", result)
+	}
+}
+
+func TestComputeHashCoversFields(t *testing.T) {
+	entry := testChain(1)[0]
+	changes := map[string]func(e *Entry){
+		"prev_hash":       func(e *Entry) { e.PrevHash = "1" + e.PrevHash[1:] },
+		"actor":           func(e *Entry) { e.Actor = "user2" },
+		"organization_id": func(e *Entry) { e.OrganizationID = 2 },
+		"entity_type":     func(e *Entry) { e.EntityType = EntityBid },
+		"entity_id":       func(e *Entry) { e.EntityID = "other" },
+		"action":          func(e *Entry) { e.Action = ActionTenderCreate },
+		"before":          func(e *Entry) { e.Before = json.RawMessage(`{}`) },
+		"after":           func(e *Entry) { e.After = nil },
+		"request_id":      func(e *Entry) { e.RequestID = "req" },
+		"created_at":      func(e *Entry) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) },
+		// Field boundaries are kept: moving text between fields is a change.
+		"boundary": func(e *Entry) { e.Actor, e.EntityType = "user1t", "ender" },
+	}
+	for name, change := range changes {
+		changed := entry
+		change(&changed)
+		if changed.computeHash() == entry.Hash {
+			t.Errorf("hash does not cover %s", name)
+		}
+	}
+}
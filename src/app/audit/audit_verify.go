@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+)
+
+type VerifyResult struct {
+	Valid    bool  `json:"valid"`
+	Checked  int   `json:"checked"`
+	BrokenID int64 `json:"brokenId,omitempty"`
+}
+
+const verifyBatchSize = 1000
+
+// chainVerifier checks the entries one by one, oldest first.
+type chainVerifier struct {
+	prev_hash string
+	result    VerifyResult
+}
+
+func newChainVerifier() *chainVerifier {
+	return &chainVerifier{prev_hash: GenesisHash}
+}
+
+// check tells whether the entry is intact and chained to the previous one;
+// if not, it is recorded as the broken one.
+func (v *chainVerifier) check(entry *Entry) bool {
+	if entry.PrevHash != v.prev_hash || entry.computeHash() != entry.Hash {
+		v.result.BrokenID = entry.ID
+		return false
+	}
+	v.result.Checked++
+	v.prev_hash = entry.Hash
+	return true
+}
+
+// Verify walks the whole chain and reports the first entry whose hash does not
+// match its content or whose prev_hash does not match the previous entry.
+func Verify(ctx context.Context, db *sql.DB) (result VerifyResult, err error) {
+	verifier := newChainVerifier()
+	last_id := int64(0)
+	for {
+		rows, err := db.QueryContext(ctx, `SELECT `+entryColumns+`
+			FROM audit_log
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2`, last_id, verifyBatchSize)
+		if err != nil {
+			return verifier.result, err
+		}
+		count := 0
+		for rows.Next() {
+			entry, err := scanEntry(rows)
+			if err != nil {
+				rows.Close()
+				return verifier.result, err
+			}
+			count++
+			if !verifier.check(&entry) {
+				rows.Close()
+				return verifier.result, nil
+			}
+			last_id = entry.ID
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return verifier.result, err
+		}
+		if count < verifyBatchSize {
+			verifier.result.Valid = true
+			return verifier.result, nil
+		}
+	}
+}
+
+func VerifyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, err_info := dbhelp.GetUserId(r.Context(), db, dbhelp.GetUserNameFromRequest(r))
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		result, err := Verify(r.Context(), db)
+		if err != nil {
+			errinfo.SendHttpErr(w, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
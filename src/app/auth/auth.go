@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go_server/m/common/errinfo"
+)
+
+// Header carries the key, "Authorization: Bearer <key>" is accepted as well.
+const Header = "X-API-Key"
+
+// Middleware admits /api/ requests only with one of the keys, /api/ping and
+// the health and metrics endpoints stay open. Without keys it does nothing.
+// The username parameter still names the employee, a key only admits the
+// calling service.
+func Middleware(keys []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(keys) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/ping" || validKey(keys, requestKey(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeUnauthorized))
+		})
+	}
+}
+
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get(Header); key != "" {
+		return key
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// validKey compares with every key in constant time.
+func validKey(keys []string, key string) bool {
+	valid := 0
+	for _, k := range keys {
+		valid |= subtle.ConstantTimeCompare([]byte(k), []byte(key))
+	}
+	return key != "" && valid == 1
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware([]string{"0123456789abcdef", "fedcba9876543210"})(ok)
+	cases := []struct {
+		path   string
+		header string
+		value  string
+		status int
+	}{
+		{"/api/tenders/my", "", "", http.StatusUnauthorized},
+		{"/api/tenders/my", Header, "wrong", http.StatusUnauthorized},
+		{"/api/tenders/my", Header, "fedcba9876543210", http.StatusOK},
+		{"/api/tenders/my", "Authorization", "Bearer 0123456789abcdef", http.StatusOK},
+		{"/api/ping", "", "", http.StatusOK},
+		{"/health/ready", "", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.path, nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != c.status {
+			t.Errorf("%s %s=%q: status %d, want %d", c.path, c.header, c.value, rec.Code, c.status)
+		}
+	}
+}
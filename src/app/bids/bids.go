@@ -1,20 +1,27 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
+	"go_server/m/logging"
 	"go_server/m/tenders"
 
 	"github.com/google/uuid"
 )
 
+// Bid author types. AuthorID is an employee or an organization id.
+const (
+	AuthorUser         = "User"
+	AuthorOrganization = "Organization"
+)
+
 type Bid struct {
 	ID          uuid.UUID `json:"id"`
 	Name        string    `json:"name" binding:"required"`
@@ -33,10 +40,9 @@ type editBidRequestBody struct {
 	Description string `json:"description,omitempty"`
 }
 
-func getBids(db *sql.DB, limit, offset int) ([]Bid, errinfo.ErrorInfo) {
+func getBids(ctx context.Context, db *sql.DB, limit, offset int) ([]Bid, errinfo.ErrorInfo) {
 	var query string
 	var args []interface{}
-	var err_info errinfo.ErrorInfo
 
 	query = `
 		SELECT id, name, description, status, author_type,author_id,tender_id, version, created_at 
@@ -47,11 +53,9 @@ func getBids(db *sql.DB, limit, offset int) ([]Bid, errinfo.ErrorInfo) {
 		`
 	args = []interface{}{limit, offset}
 
-	rows, err := db.Query(query, args...)
-	err_info.Status = dbhelp.SqlErrToStatus(err, 500)
+	rows, err := db.QueryContext(ctx, query, args...)
+	err_info := dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 	if err_info.Status != 200 {
-		err_info.Reason = errinfo.ErrMessageServer
-		log.Println(err)
 		return nil, err_info
 	}
 	defer rows.Close()
@@ -59,26 +63,19 @@ func getBids(db *sql.DB, limit, offset int) ([]Bid, errinfo.ErrorInfo) {
 	for rows.Next() {
 		var bid Bid
 		if err := rows.Scan(&bid.ID, &bid.Name, &bid.Description, &bid.Status, &bid.AuthorType, &bid.AuthorID, &bid.TenderID, &bid.Version, &bid.CreatedAt); err != nil {
-			err_info.Reason = errinfo.ErrMessageServer
-			err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-			log.Println(err)
-			return nil, err_info
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		}
 		bids = append(bids, bid)
 	}
 	if err := rows.Err(); err != nil {
-		err_info.Reason = errinfo.ErrMessageServer
-		err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-		log.Println(err)
-		return nil, err_info
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 	}
 
 	return bids, err_info
 }
 
-func getBid(db *sql.DB, bid_id uuid.UUID) (*Bid, errinfo.ErrorInfo) {
-	var err_info errinfo.ErrorInfo
-	err_info.Status = 200
+func GetBid(ctx context.Context, db dbhelp.Querier, bid_id uuid.UUID) (*Bid, errinfo.ErrorInfo) {
+	err_info := errinfo.Ok()
 
 	query := `
 		SELECT id, name, description, status, author_type, author_id, tender_id, version, approve_count,created_at 
@@ -86,9 +83,9 @@ func getBid(db *sql.DB, bid_id uuid.UUID) (*Bid, errinfo.ErrorInfo) {
 		WHERE id = $1
 		LIMIT 1
 		`
-	rows, err := db.Query(query, bid_id)
+	rows, err := db.QueryContext(ctx, query, bid_id)
 	if err != nil {
-		err_info = dbhelp.SqlErrToErrInfo(err, 500, errinfo.ErrMessageServer)
+		err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		return nil, err_info
 	}
 	defer rows.Close()
@@ -96,27 +93,26 @@ func getBid(db *sql.DB, bid_id uuid.UUID) (*Bid, errinfo.ErrorInfo) {
 	var bid Bid
 	if rows.Next() {
 		if err := rows.Scan(&bid.ID, &bid.Name, &bid.Description, &bid.Status, &bid.AuthorType, &bid.AuthorID, &bid.TenderID, &bid.Version, &bid.AproveCount, &bid.CreatedAt); err != nil {
-			err_info = dbhelp.SqlErrToErrInfo(err, 500, errinfo.ErrMessageServer)
+			err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 			return nil, err_info
 		}
 		return &bid, err_info
 	}
-	err_info = dbhelp.SqlErrToErrInfo(sql.ErrNoRows, 404, errinfo.ErrMessageBidNotFound)
+	err_info = errinfo.New(errinfo.CodeBidNotFound)
 
 	return nil, err_info
 }
 
 func BidsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
-		log.Println("GettingBids")
+		logging.FromRequest(r).Debug("listing all bids")
 		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
 
-		bids, err_info := getBids(db, limit, offset)
+		bids, err_info := getBids(r.Context(), db, limit, offset)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
@@ -144,21 +140,44 @@ type CreateBidData struct {
 	TenderID    uuid.UUID `json:"tenderId"`
 	AuthorType  string    `json:"authorType"`
 	AuthorId    int       `json:"authorId"`
+	// CreatorUsername is the employee submitting a bid of an organization.
+	CreatorUsername string `json:"creatorUsername"`
 }
 
-func hasUserAccesstoTender(db *sql.DB, user_name string, tender_id uuid.UUID) errinfo.ErrorInfo {
+// IsBidAuthor tells whether the user authored the bid or is responsible for
+// the organization that did.
+func IsBidAuthor(ctx context.Context, db *sql.DB, bid *Bid, user_id int) (bool, errinfo.ErrorInfo) {
+	if bid.AuthorType != AuthorOrganization {
+		return bid.AuthorID == user_id, errinfo.Ok()
+	}
+	err_info := dbhelp.IsUserInOrganization(ctx, db, user_id, bid.AuthorID)
+	if err_info.Code == errinfo.CodeNoPermission {
+		return false, errinfo.Ok()
+	}
+	return err_info.Status == 200, err_info
+}
 
-	user_id, err_info := dbhelp.GetUserId(db, user_name)
-	if err_info.Status != 200 {
-		return err_info
+// hasUserAccesstoTender lets the organizations of the tender see its bids.
+func hasUserAccesstoTender(ctx context.Context, db *sql.DB, user_name string, tender_id uuid.UUID) (*tenders.Tender, errinfo.ErrorInfo) {
+	access, err_info := tenders.GetAccess(ctx, db, user_name, tender_id)
+	if err_info.Status == 200 {
+		err_info = access.Err()
 	}
-	tender, err_info := tenders.GetTender(db, tender_id)
 	if err_info.Status != 200 {
-		return err_info
+		return nil, err_info
+	}
+	return access.Tender, err_info
+}
+
+// hasUserRightOnTender lets those organizations having tenders.RightBids
+// change the bids.
+func hasUserRightOnTender(ctx context.Context, db *sql.DB, user_name string, tender_id uuid.UUID) (*tenders.Tender, errinfo.ErrorInfo) {
+	access, err_info := tenders.GetAccess(ctx, db, user_name, tender_id)
+	if err_info.Status == 200 {
+		err_info = access.Allow(tenders.RightBids)
 	}
-	err_info = dbhelp.IsUserInOrganization(db, user_id, tender.OrganizationID)
 	if err_info.Status != 200 {
-		return err_info
+		return nil, err_info
 	}
-	return err_info
+	return access.Tender, err_info
 }
@@ -1,22 +1,22 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
-	"log"
+	"go_server/m/logging"
+	"go_server/m/tenders"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
-func editBid(db *sql.DB, bid *Bid, req_body *editBidRequestBody) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
-	err_info.Status = 200
-
-	err_info = archiveBid(db, bid)
+func editBid(ctx context.Context, db dbhelp.Querier, bid *Bid, req_body *editBidRequestBody) errinfo.ErrorInfo {
+	err_info := archiveBid(ctx, db, bid, RevisionEdit, "")
 	if err_info.Status != 200 {
 		return err_info
 	}
@@ -29,89 +29,103 @@ func editBid(db *sql.DB, bid *Bid, req_body *editBidRequestBody) errinfo.ErrorIn
 		bid.Description = req_body.Description
 	}
 
-	err_info = updateBid(db, bid)
+	err_info = updateBid(ctx, db, bid)
 
 	return err_info
 }
 
-func archiveBid(db *sql.DB, bid *Bid) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
+// archiveBid stores the current version of the bid together with the event
+// that replaces it, so bids_archive holds the whole revision chain.
+func archiveBid(ctx context.Context, db dbhelp.Querier, bid *Bid, event, reason string) errinfo.ErrorInfo {
 	query := `
-		INSERT INTO bids_archive (id,name, description, version)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO bids_archive (id, name, description, version, status, event, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
 		RETURNING id`
 
-	err := db.QueryRow(query, bid.ID, bid.Name, bid.Description, bid.Version).Scan(&bid.ID)
-	err_info.Status = dbhelp.SqlErrToStatus(err, http.StatusInternalServerError)
-	if err_info.Status != 200 {
-		err_info.Reason = errinfo.ErrMessageServer
-	}
-	return err_info
+	err := db.QueryRowContext(ctx, query, bid.ID, bid.Name, bid.Description, bid.Version, bid.Status, event, reason).Scan(&bid.ID)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 
 }
 
-func updateBid(db *sql.DB, bid *Bid) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
+func updateBid(ctx context.Context, db dbhelp.Querier, bid *Bid) errinfo.ErrorInfo {
 	query := `UPDATE bids 
-	SET name = $1, description = $2, version = $3
-	WHERE id = $4
+	SET name = $1, description = $2, version = $3, status = $4
+	WHERE id = $5
 	`
-	_, err := db.Exec(query, bid.Name, bid.Description, bid.Version, bid.ID)
-	if err != nil {
-		log.Println(err)
-	}
-	err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-	err_info.Reason = errinfo.ErrMessageServer
-	return err_info
+	_, err := db.ExecContext(ctx, query, bid.Name, bid.Description, bid.Version, bid.Status, bid.ID)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 
 }
 
-func validateEditBidParams(req_body *editBidRequestBody) bool {
-
-	if req_body.Description != "" && len(req_body.Description) > 100 {
-		return false
+// checkBidEditor lets the bid author, or an employee of the authoring
+// organization, edit the bid while the tender is open. The tender
+// organizations having tenders.RightBids may edit it too.
+func checkBidEditor(ctx context.Context, db *sql.DB, user_name string, bid *Bid) (*tenders.Tender, errinfo.ErrorInfo) {
+	user_id, err_info := dbhelp.GetUserId(ctx, db, user_name)
+	if err_info.Status != 200 {
+		return nil, err_info
 	}
-	if req_body.Name != "" && len(req_body.Name) > 100 {
-		return false
+	is_author, err_info := IsBidAuthor(ctx, db, bid, user_id)
+	if err_info.Status != 200 {
+		return nil, err_info
 	}
-
-	return true
-
+	if !is_author {
+		return hasUserRightOnTender(ctx, db, user_name, bid.TenderID)
+	}
+	tender, err_info := tenders.GetTender(ctx, db, bid.TenderID)
+	if err_info.Status == 200 && tender.Status == "Closed" {
+		err_info = errinfo.New(errinfo.CodeTenderClosed)
+	}
+	return tender, err_info
 }
 
 func EditBidsHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
 		vars := mux.Vars(r)
 		s_bid_id := vars["bidId"]
 		user_name := r.URL.Query().Get("username")
 
 		var req_body editBidRequestBody
 		bid_id, err_info := helpers.ParseUUID(s_bid_id)
-		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil || err_info.Status != 200 || !validateEditBidParams(&req_body) {
-			err_info.Reason = errinfo.ErrMessageWrongRequest
-			err_info.Status = 400
-			log.Println(err_info.Reason)
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			err_info = errinfo.New(errinfo.CodeWrongRequest)
+		}
+		if err_info.Status != 200 {
+			logging.FromRequest(r).Debug("invalid edit request", "reason", err_info.Reason)
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
 
-		bid, err_info := getBid(db, bid_id)
+		bid, err_info := GetBid(r.Context(), db, bid_id)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
 
-		err_info = hasUserAccesstoTender(db, user_name, bid.TenderID)
+		tender, err_info := checkBidEditor(r.Context(), db, user_name, bid)
 		if err_info.Status != 200 {
 
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
-		err_info = editBid(db, bid, &req_body)
+		before := *bid
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			*bid = before
+			if err_info := editBid(r.Context(), tx, bid, &req_body); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityBid,
+				EntityID:       bid.ID.String(),
+				Action:         audit.ActionBidEdit,
+				Before:         before,
+				After:          bid,
+			})
+		})
 		if err_info.Status != 200 {
-
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
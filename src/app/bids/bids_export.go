@@ -0,0 +1,176 @@
+package bids
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/export"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// decisionState is recorded in the audit log for a decision, so the
+// decision history keeps decisions that did not change the bid status.
+type decisionState struct {
+	*Bid
+	Decision string `json:"decision"`
+}
+
+func checkExportParams(r *http.Request) (format string, limit sql.NullInt64, offset int, tender_id uuid.UUID, err_info errinfo.ErrorInfo) {
+	format, err_info = export.ParseFormat(r)
+	if err_info.Status != 200 {
+		return
+	}
+	limit, offset, err_info = export.LimitOffset(r)
+	if err_info.Status != 200 {
+		return
+	}
+	tender_id, err_info = helpers.ParseUUID(mux.Vars(r)["tenderId"])
+	return
+}
+
+// BidsTable selects the bids of the tender, a NULL limit selects all of them.
+func BidsTable(ctx context.Context, db *sql.DB, tender_id uuid.UUID, limit sql.NullInt64, offset int) (*export.Table, errinfo.ErrorInfo) {
+	query := `
+	SELECT id, name, description, status, author_type, author_id, version, approve_count, created_at
+	FROM bids
+	WHERE tender_id = $1
+	ORDER BY name
+	LIMIT $2 OFFSET $3
+	`
+	rows, err := db.QueryContext(ctx, query, tender_id, limit, offset)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	header := []string{"id", "name", "description", "status", "author_type", "author_id", "version", "approve_count", "created_at"}
+	return &export.Table{Name: "bids", Header: header, Rows: rows, Scan: func() ([]interface{}, error) {
+		var bid Bid
+		err := rows.Scan(&bid.ID, &bid.Name, &bid.Description, &bid.Status, &bid.AuthorType, &bid.AuthorID,
+			&bid.Version, &bid.AproveCount, &bid.CreatedAt)
+		return []interface{}{bid.ID.String(), bid.Name, bid.Description, bid.Status, bid.AuthorType, bid.AuthorID,
+			bid.Version, bid.AproveCount, bid.CreatedAt}, err
+	}}, errinfo.Ok()
+}
+
+// ReviewsTable selects the feedback on the bids of the user to the tender.
+func ReviewsTable(ctx context.Context, db *sql.DB, tender_id uuid.UUID, author_id int, limit sql.NullInt64, offset int) (*export.Table, errinfo.ErrorInfo) {
+	query := `
+	SELECT br.id, br.bid_id, b.name, br.author_name, br.description, br.created_at
+	FROM bids_reviews br
+	JOIN bids b ON b.id = br.bid_id
+	WHERE b.tender_id = $1 AND b.author_type = 'User' AND b.author_id = $2
+	ORDER BY br.id
+	LIMIT $3 OFFSET $4
+	`
+	rows, err := db.QueryContext(ctx, query, tender_id, author_id, limit, offset)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	header := []string{"id", "bid_id", "bid_name", "author_name", "description", "created_at"}
+	return &export.Table{Name: "reviews", Header: header, Rows: rows, Scan: func() ([]interface{}, error) {
+		var review BidReview
+		var bid_name string
+		err := rows.Scan(&review.Id, &review.BidId, &bid_name, &review.AuthorName, &review.Description, &review.CreatedAt)
+		return []interface{}{review.Id, review.BidId.String(), bid_name, review.AuthorName, review.Description, review.CreatedAt}, err
+	}}, errinfo.Ok()
+}
+
+// DecisionsTable selects the decisions on the bids of the tender from the
+// audit log, oldest first.
+func DecisionsTable(ctx context.Context, db *sql.DB, tender_id uuid.UUID, limit sql.NullInt64, offset int) (*export.Table, errinfo.ErrorInfo) {
+	query := `
+	SELECT a.created_at, a.actor, b.id, b.name,
+		COALESCE(a.after_data->>'decision', ''),
+		COALESCE(a.before_data->>'status', ''),
+		COALESCE(a.after_data->>'status', '')
+	FROM audit_log a
+	JOIN bids b ON b.id::text = a.entity_id
+	WHERE a.entity_type = 'bid' AND a.action = 'bid.decision' AND b.tender_id = $1
+	ORDER BY a.id
+	LIMIT $2 OFFSET $3
+	`
+	rows, err := db.QueryContext(ctx, query, tender_id, limit, offset)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	header := []string{"created_at", "actor", "bid_id", "bid_name", "decision", "status_before", "status_after"}
+	return &export.Table{Name: "decisions", Header: header, Rows: rows, Scan: func() ([]interface{}, error) {
+		var created_at time.Time
+		var bid_id uuid.UUID
+		var actor, bid_name, decision, status_before, status_after string
+		err := rows.Scan(&created_at, &actor, &bid_id, &bid_name, &decision, &status_before, &status_after)
+		return []interface{}{created_at, actor, bid_id.String(), bid_name, decision, status_before, status_after}, err
+	}}, errinfo.Ok()
+}
+
+// ExportBidsHandler streams the bids of /api/bids/{tenderId}/list.
+func ExportBidsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, limit, offset, tender_id, err_info := checkExportParams(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		_, err_info = hasUserAccesstoTender(r.Context(), db, r.URL.Query().Get("username"), tender_id)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		table, err_info := BidsTable(r.Context(), db, tender_id, limit, offset)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		export.Send(w, r, format, table)
+	}
+}
+
+// ExportReviewsHandler streams the feedback of /api/bids/{tenderId}/reviews.
+func ExportReviewsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, limit, offset, _, err_info := checkExportParams(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		author_id, tender_id, err_info := checkReviewParams(db, r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		table, err_info := ReviewsTable(r.Context(), db, tender_id, author_id, limit, offset)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		export.Send(w, r, format, table)
+	}
+}
+
+// ExportDecisionsHandler streams the decisions on the bids of a tender.
+func ExportDecisionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, limit, offset, tender_id, err_info := checkExportParams(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		_, err_info = hasUserAccesstoTender(r.Context(), db, r.URL.Query().Get("username"), tender_id)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		table, err_info := DecisionsTable(r.Context(), db, tender_id, limit, offset)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		export.Send(w, r, format, table)
+	}
+}
@@ -1,12 +1,16 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
-	"log"
+	"go_server/m/logging"
+	"go_server/m/metrics"
+	"go_server/m/tenders"
 	"net/http"
 	"time"
 
@@ -15,56 +19,46 @@ import (
 )
 
 type BidReview struct {
-	Id          uuid.UUID `json:"id"`
+	Id          int       `json:"id"`
 	Description string    `json:"description" binding:"required"`
 	BidId       uuid.UUID `json:"-"`
 	AuthorName  string    `json:"-"`
 	CreatedAt   time.Time `json:"created_at" gorm:"default:current_timestamp"`
 }
 
-func createReview(db *sql.DB, bid_review *BidReview) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
+func createReview(ctx context.Context, db dbhelp.Querier, bid_review *BidReview) errinfo.ErrorInfo {
 	query := `
 		INSERT INTO bids_reviews (bid_id, author_name ,description)
 		VALUES ($1, $2, $3)
-		RETURNING id
+		RETURNING id, created_at
 	`
-	err := db.QueryRow(query, bid_review.BidId, bid_review.Description, bid_review.Description).Scan(&bid_review.Id)
-	err_info.Status = dbhelp.SqlErrToStatus(err, http.StatusInternalServerError)
-	if err_info.Status != 200 {
-		err_info.Reason = errinfo.ErrMessageServer
-	}
-
-	return err_info
+	err := db.QueryRowContext(ctx, query, bid_review.BidId, bid_review.AuthorName, bid_review.Description).Scan(&bid_review.Id, &bid_review.CreatedAt)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 
 }
 
-func checkFeedbackParams(db *sql.DB, r *http.Request) (bid_review BidReview, err_info errinfo.ErrorInfo) {
-	err_info.Init(200, "Ok")
+func checkFeedbackParams(db *sql.DB, r *http.Request) (bid_review BidReview, tender *tenders.Tender, err_info errinfo.ErrorInfo) {
 	vars := mux.Vars(r)
 	s_bid_id := vars["bidId"]
 	user_name := r.URL.Query().Get("username")
 	review := r.URL.Query().Get("bidFeedback")
 
 	if len(review) > 1000 || len(review) == 0 {
-		log.Println("Review LEN ", len(review))
-		err_info.Status = 400
-		err_info.Reason = errinfo.ErrMessageWrongRequest
+		err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("bidFeedback", "Must be from 1 to 1000 characters.")
 		return
 	}
 
 	bid_id, err_info := helpers.ParseUUID(s_bid_id)
 	if err_info.Status != 200 {
-		log.Println("ID not numb")
 		return
 	}
-	bid, err_info := getBid(db, bid_id)
+	bid, err_info := GetBid(r.Context(), db, bid_id)
 	if err_info.Status != 200 {
-		log.Println("NO BID", bid_id)
+		logging.FromRequest(r).Debug("bid not found", "bid_id", bid_id)
 		return
 	}
 
-	err_info = hasUserAccesstoTender(db, user_name, bid.TenderID)
+	tender, err_info = hasUserRightOnTender(r.Context(), db, user_name, bid.TenderID)
 
 	if err_info.Status != 200 {
 		return
@@ -78,16 +72,29 @@ func checkFeedbackParams(db *sql.DB, r *http.Request) (bid_review BidReview, err
 func FeedbackHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		bid_review, err_info := checkFeedbackParams(db, r)
+		bid_review, tender, err_info := checkFeedbackParams(db, r)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
-		createReview(db, &bid_review)
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := createReview(r.Context(), tx, &bid_review); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          bid_review.AuthorName,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityBid,
+				EntityID:       bid_review.BidId.String(),
+				Action:         audit.ActionBidFeedback,
+				After:          bid_review,
+			})
+		})
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
+		metrics.BidFeedback.Inc()
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(bid_review)
@@ -1,6 +1,7 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"go_server/m/common/dbhelp"
@@ -9,18 +10,19 @@ import (
 	"net/http"
 )
 
-func getUserBids(db *sql.DB, user_id, limit, offset int) ([]Bid, errinfo.ErrorInfo) {
-	var err_info errinfo.ErrorInfo
-	err_info.Reason = errinfo.ErrMessageServer
+func getUserBids(ctx context.Context, db *sql.DB, user_id, limit, offset int) ([]Bid, errinfo.ErrorInfo) {
 	query := `
 	SELECT id, name, description, status, author_type, author_id, tender_id, version, created_at
 	FROM bids
-	WHERE author_id = $1
+	WHERE (author_type = 'User' AND author_id = $1)
+	   OR (author_type = 'Organization' AND author_id IN (
+	       SELECT organization_id FROM organization_responsible WHERE user_id = $1
+	   ))
 	ORDER BY name
 	LIMIT $2 OFFSET $3
 	`
-	rows, err := db.Query(query, user_id, limit, offset)
-	err_info.Status = dbhelp.SqlErrToStatus(err, 200)
+	rows, err := db.QueryContext(ctx, query, user_id, limit, offset)
+	err_info := dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 	if err_info.Status != 200 {
 		return nil, err_info
 	}
@@ -29,12 +31,11 @@ func getUserBids(db *sql.DB, user_id, limit, offset int) ([]Bid, errinfo.ErrorIn
 	for rows.Next() {
 		var bid Bid
 		if err := rows.Scan(&bid.ID, &bid.Name, &bid.Description, &bid.Status, &bid.AuthorType, &bid.AuthorID, &bid.TenderID, &bid.Version, &bid.CreatedAt); err != nil {
-			err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-			return nil, err_info
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		}
 		bids = append(bids, bid)
 	}
-	err_info.Status = dbhelp.SqlErrToStatus(rows.Err(), 500)
+	err_info = dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
 	return bids, err_info
 
 }
@@ -43,8 +44,6 @@ func MyBidsHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		var err_info errinfo.ErrorInfo
-
 		w.Header().Set("Content-Type", "application/json")
 
 		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
@@ -52,11 +51,11 @@ func MyBidsHandler(db *sql.DB) http.HandlerFunc {
 		var user_id int
 		if err_info.Status == 200 {
 			user_name := r.URL.Query().Get("username")
-			user_id, err_info = dbhelp.GetUserId(db, user_name)
+			user_id, err_info = dbhelp.GetUserId(r.Context(), db, user_name)
 
 		}
 		if err_info.Status == 200 {
-			bids, err_info = getUserBids(db, user_id, limit, offset)
+			bids, err_info = getUserBids(r.Context(), db, user_id, limit, offset)
 		}
 
 		if err_info.Status != 200 {
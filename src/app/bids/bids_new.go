@@ -1,82 +1,181 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
+	"go_server/m/metrics"
+	"go_server/m/qualifications"
 	"go_server/m/tenders"
 	"net/http"
 	"time"
 )
 
-func validateNewBid(new_bid *CreateBidData) bool {
-	if len(new_bid.Name) > 100 {
-		return false
+func createBid(ctx context.Context, db dbhelp.Querier, bid *Bid) errinfo.ErrorInfo {
+
+	query := `
+		INSERT INTO bids (name, description,status, author_type, author_id, tender_id, version, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`
+	err := db.QueryRowContext(ctx, query, bid.Name, bid.Description, bid.Status, bid.AuthorType, bid.AuthorID, bid.TenderID, bid.Version, bid.CreatedAt).Scan(&bid.ID)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+
+}
+
+// bidCreator resolves the employee submitting the bid: the author of a
+// user bid, or a responsible employee of the authoring organization.
+func bidCreator(ctx context.Context, db *sql.DB, req *CreateBidData) (user_id int, user_name string, err_info errinfo.ErrorInfo) {
+	switch req.AuthorType {
+	case AuthorUser:
+		user_id = req.AuthorId
+		user_name, err_info = dbhelp.GetUserName(ctx, db, user_id)
+	case AuthorOrganization:
+		if req.CreatorUsername == "" {
+			err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("creatorUsername", "Required for bids of an organization.")
+			return
+		}
+		user_name = req.CreatorUsername
+		user_id, err_info = dbhelp.GetUserId(ctx, db, user_name)
+		if err_info.Status != 200 {
+			return
+		}
+		if _, err_info = dbhelp.GetOrganization(ctx, db, req.AuthorId); err_info.Status != 200 {
+			return
+		}
+		err_info = dbhelp.IsUserInOrganization(ctx, db, user_id, req.AuthorId)
+	default:
+		err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("authorType", "Must be User or Organization.")
 	}
-	if len(new_bid.Description) > 100 {
-		return false
+	return
+}
+
+// authorStanding tells in one round trip whether the organization
+// co-owns the tender and whether it is invited to it.
+func authorStanding(ctx context.Context, db *sql.DB, tender *tenders.Tender, organization_id int) (co_owner, invited bool, err_info errinfo.ErrorInfo) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM tender_owners WHERE tender_id = $1 AND organization_id = $2),
+	       EXISTS (SELECT 1 FROM tender_invitations WHERE tender_id = $1 AND organization_id = $2)
+	`
+	err := db.QueryRowContext(ctx, query, tender.ID, organization_id).Scan(&co_owner, &invited)
+	return co_owner, invited, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+}
+
+// bidTender loads the tender of the new bid, reported missing when it is
+// hidden from the bidder. The author of a user bid must see the tender. An
+// organization may not bid on its own tenders nor on internal ones, and
+// on an invite-only one only if invited. Employees of the tender
+// organizations may not bid on it in their own name either. Bids are only
+// taken while the tender is published.
+func bidTender(ctx context.Context, db *sql.DB, req *CreateBidData, user_id int) (*tenders.Tender, errinfo.ErrorInfo) {
+	access, err_info := tenders.GetAccessByUserId(ctx, db, user_id, req.TenderID)
+	if err_info.Status != 200 {
+		return nil, err_info
 	}
-	if len(new_bid.TenderID) > 100 {
-		return false
+	tender := access.Tender
+	if req.AuthorType == AuthorOrganization {
+		err_info = checkAuthorOrganization(ctx, db, tender, req.AuthorId)
+	} else if err_info = access.VisibleErr(); err_info.Status == 200 && access.Responsible {
+		err_info = errinfo.New(errinfo.CodeOwnTender)
 	}
-	if new_bid.AuthorType != "User" && new_bid.AuthorType != "Organization" {
-		return false
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	switch tender.Status {
+	case "Published":
+		return tender, errinfo.Ok()
+	case "Closed":
+		return nil, errinfo.New(errinfo.CodeTenderClosed)
 	}
-	return true
+	return nil, errinfo.New(errinfo.CodeTenderNotPublished)
 }
 
-func createBid(db *sql.DB, bid *Bid) errinfo.ErrorInfo {
+// checkAuthorOrganization keeps the organization from bidding on its own
+// tenders and on those hidden from it.
+func checkAuthorOrganization(ctx context.Context, db *sql.DB, tender *tenders.Tender, organization_id int) errinfo.ErrorInfo {
+	if tender == nil {
+		return errinfo.New(errinfo.CodeTenderNotFound)
+	}
+	if tender.OrganizationID == organization_id {
+		return errinfo.New(errinfo.CodeOwnTender)
+	}
+	co_owner, invited, err_info := authorStanding(ctx, db, tender, organization_id)
+	switch {
+	case err_info.Status != 200:
+		return err_info
+	case co_owner:
+		return errinfo.New(errinfo.CodeOwnTender)
+	case tender.Visibility == tenders.VisibilityInternal,
+		tender.Visibility == tenders.VisibilityInviteOnly && !invited:
+		return errinfo.New(errinfo.CodeTenderNotFound)
+	}
+	return errinfo.Ok()
+}
 
+// checkQualification requires a valid qualification for the service type
+// of a tender that asks for one: of the authoring organization, or for a
+// user bid of one of the author's organizations.
+func checkQualification(ctx context.Context, db *sql.DB, tender *tenders.Tender, req *CreateBidData, user_id int) errinfo.ErrorInfo {
+	if !tender.RequiresQualification {
+		return errinfo.Ok()
+	}
+	var qualified bool
 	var err_info errinfo.ErrorInfo
-	query := `
-		INSERT INTO bids (name, description,status, author_type, author_id, tender_id, version, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id`
-	err := db.QueryRow(query, bid.Name, bid.Description, bid.Status, bid.AuthorType, bid.AuthorID, bid.TenderID, bid.Version, bid.CreatedAt).Scan(&bid.ID)
-	err_info.Status = dbhelp.SqlErrToStatus(err, http.StatusInternalServerError)
-	if err_info.Status != 200 {
-		err_info.Reason = errinfo.ErrMessageServer
+	if req.AuthorType == AuthorOrganization {
+		qualified, err_info = qualifications.IsQualified(ctx, db, req.AuthorId, tender.ServiceType)
+	} else {
+		qualified, err_info = qualifications.IsUserQualified(ctx, db, user_id, tender.ServiceType)
+	}
+	if err_info.Status == 200 && !qualified {
+		err_info = errinfo.New(errinfo.CodeNotQualified)
 	}
-
 	return err_info
-
 }
 
+// NewBidHandler creates a bid of an employee, or of an organization on
+// behalf of one of its responsible employees.
 func NewBidHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
-		err_info.Status = 200
 		var req CreateBidData
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validateNewBid(&req) {
-			err_info.Reason = errinfo.ErrMessageWrongRequest
-			err_info.Status = 400
-			errinfo.SendHttpErr(w, err_info)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
 			return
 		}
-		user_name, err_info := dbhelp.GetUserName(db, req.AuthorId)
+		user_id, user_name, err_info := bidCreator(r.Context(), db, &req)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
-		tender, err_info := tenders.GetTender(db, req.TenderID)
-		if err_info.Status != 200 {
-			errinfo.SendHttpErr(w, err_info)
-			return
+		tender, err_info := bidTender(r.Context(), db, &req, user_id)
+		if err_info.Status == 200 {
+			err_info = checkQualification(r.Context(), db, tender, &req, user_id)
 		}
-
-		_, err_info = dbhelp.IsUserExistAndResponsible(db, user_name, tender.OrganizationID)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
 		bid := createBidDataToBid(req, 1, time.Now())
-		err_info = createBid(db, bid)
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := createBid(r.Context(), tx, bid); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityBid,
+				EntityID:       bid.ID.String(),
+				Action:         audit.ActionBidCreate,
+				After:          bid,
+			})
+		})
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
+		metrics.BidsSubmitted.Inc()
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(bid)
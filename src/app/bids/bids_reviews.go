@@ -1,6 +1,7 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"go_server/m/common/dbhelp"
@@ -13,18 +14,17 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func getReviews(db *sql.DB, tender_id uuid.UUID, user_id, limit, offset int) ([]BidReview, errinfo.ErrorInfo) {
-	var err_info errinfo.ErrorInfo
+func getReviews(ctx context.Context, db *sql.DB, tender_id uuid.UUID, user_id, limit, offset int) ([]BidReview, errinfo.ErrorInfo) {
 	query := `
 		SELECT br.id, br.bid_id, br.author_name, br.description, br.created_at 
 		FROM bids_reviews br
-		JOIN (SELECT id, tender_id FROM bids WHERE tender_id = $3 AND author_id = $4) AS b ON b.id = br.bid_id
+		JOIN (SELECT id, tender_id FROM bids WHERE tender_id = $3 AND author_type = 'User' AND author_id = $4) AS b ON b.id = br.bid_id
 		LIMIT $1
 		OFFSET $2
 	`
 	var reviews []BidReview
-	rows, err := db.Query(query, limit, offset, tender_id, user_id)
-	err_info = dbhelp.SqlErrToErrInfo(err, 404, "Reviews not found.")
+	rows, err := db.QueryContext(ctx, query, limit, offset, tender_id, user_id)
+	err_info := dbhelp.SqlErrToErrInfo(err, errinfo.CodeReviewsNotFound)
 	if err_info.Status != 200 {
 		return nil, err_info
 	}
@@ -33,19 +33,17 @@ func getReviews(db *sql.DB, tender_id uuid.UUID, user_id, limit, offset int) ([]
 	for rows.Next() {
 		var review BidReview
 		if err := rows.Scan(&review.Id, &review.BidId, &review.AuthorName, &review.Description, &review.CreatedAt); err != nil {
-			err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-			return nil, err_info
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		}
 		reviews = append(reviews, review)
 	}
-	err_info.Status = dbhelp.SqlErrToStatus(rows.Err(), 500)
+	err_info = dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
 
 	return reviews, err_info
 
 }
 
 func checkReviewParams(db *sql.DB, r *http.Request) (author_id int, tender_id uuid.UUID, err_info errinfo.ErrorInfo) {
-	err_info.Init(200, "Ok")
 	vars := mux.Vars(r)
 	s_tender_id := vars["tenderId"]
 	author_name := r.URL.Query().Get("authorUsername")
@@ -53,11 +51,11 @@ func checkReviewParams(db *sql.DB, r *http.Request) (author_id int, tender_id uu
 	author_id = 0
 
 	if len(s_tender_id) > 100 || len(s_tender_id) == 0 {
-		err_info.Status = 400
-		err_info.Reason = errinfo.ErrMessageWrongRequest
+		err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("tenderId", "Must be from 1 to 100 characters.")
+		return
 	}
 
-	author_id, err_info = dbhelp.GetUserId(db, author_name)
+	author_id, err_info = dbhelp.GetUserId(r.Context(), db, author_name)
 	if err_info.Status != 200 {
 		return
 	}
@@ -66,18 +64,16 @@ func checkReviewParams(db *sql.DB, r *http.Request) (author_id int, tender_id uu
 	if err_info.Status != 200 {
 		return
 	}
-	tender, err_info := tenders.GetTender(db, tender_id)
-	if err_info.Status != 200 {
-		return
+	access, err_info := tenders.GetAccess(r.Context(), db, requester_name, tender_id)
+	if err_info.Status == 200 {
+		err_info = access.TenderErr()
 	}
-
-	requester_id, err_info := dbhelp.IsUserExistAndResponsible(db, requester_name, tender.OrganizationID)
 	if err_info.Status != 200 {
 		return
 	}
 
-	if tender.AuthorID != requester_id {
-		err_info.Init(403, "User is not tender author.")
+	if access.Tender.AuthorID != access.UserID {
+		err_info = errinfo.New(errinfo.CodeNotTenderAuthor)
 	}
 	return
 
@@ -85,8 +81,6 @@ func checkReviewParams(db *sql.DB, r *http.Request) (author_id int, tender_id uu
 
 func ReviewsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
-		err_info.Init(200, "Ok")
 		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
@@ -97,7 +91,7 @@ func ReviewsHandler(db *sql.DB) http.HandlerFunc {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
-		reviews, err_info := getReviews(db, tender_id, author_id, limit, offset)
+		reviews, err_info := getReviews(r.Context(), db, tender_id, author_id, limit, offset)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
@@ -0,0 +1,268 @@
+package bids
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go_server/m/audit"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/tenders"
+
+	"github.com/gorilla/mux"
+)
+
+// Events stored with archived versions of a bid.
+const (
+	RevisionEdit     = "edit"
+	RevisionRollback = "rollback"
+	RevisionWithdraw = "withdraw"
+	RevisionResubmit = "resubmit"
+)
+
+// StatusCanceled is the status of a withdrawn bid.
+const StatusCanceled = "Canceled"
+
+type BidRevision struct {
+	Version     int        `json:"version"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	Event       string     `json:"event,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+}
+
+type withdrawBidRequestBody struct {
+	Reason string `json:"reason"`
+}
+
+type resubmitBidRequestBody struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// checkBidAuthor loads the bid and its tender for an action only the bid
+// author, or an employee of the authoring organization, may take.
+func checkBidAuthor(db *sql.DB, r *http.Request) (bid *Bid, tender *tenders.Tender, err_info errinfo.ErrorInfo) {
+	bid_id, err_info := helpers.ParseUUID(mux.Vars(r)["bidId"])
+	if err_info.Status != 200 {
+		return
+	}
+	user_id, err_info := dbhelp.GetUserId(r.Context(), db, r.URL.Query().Get("username"))
+	if err_info.Status != 200 {
+		return
+	}
+	bid, err_info = GetBid(r.Context(), db, bid_id)
+	if err_info.Status != 200 {
+		return
+	}
+	is_author, err_info := IsBidAuthor(r.Context(), db, bid, user_id)
+	if err_info.Status == 200 && !is_author {
+		err_info = errinfo.New(errinfo.CodeNotBidAuthor)
+	}
+	if err_info.Status != 200 {
+		return
+	}
+	tender, err_info = tenders.GetTender(r.Context(), db, bid.TenderID)
+	if err_info.Status != 200 {
+		return
+	}
+	if tender.Status == "Closed" {
+		err_info = errinfo.New(errinfo.CodeTenderClosed)
+	}
+	return
+}
+
+// reviseBid archives the current version with the event and reason and
+// stores the revised bid as the next version.
+func reviseBid(ctx context.Context, db dbhelp.Querier, current_bid, revised_bid *Bid, event, reason string) errinfo.ErrorInfo {
+	err_info := archiveBid(ctx, db, current_bid, event, reason)
+	if err_info.Status != 200 {
+		return err_info
+	}
+	revised_bid.Version = current_bid.Version + 1
+	return updateBid(ctx, db, revised_bid)
+}
+
+func getBidRevisions(ctx context.Context, db *sql.DB, bid *Bid) ([]BidRevision, errinfo.ErrorInfo) {
+	query := `
+		SELECT version, name, description, COALESCE(status, ''), COALESCE(event, ''), COALESCE(reason, ''), archived_at
+		FROM bids_archive
+		WHERE id = $1
+		ORDER BY version, unique_id
+	`
+	rows, err := db.QueryContext(ctx, query, bid.ID)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+
+	revisions := []BidRevision{}
+	for rows.Next() {
+		var revision BidRevision
+		var archived_at sql.NullTime
+		err := rows.Scan(&revision.Version, &revision.Name, &revision.Description, &revision.Status,
+			&revision.Event, &revision.Reason, &archived_at)
+		if err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		if archived_at.Valid {
+			revision.ArchivedAt = &archived_at.Time
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	revisions = append(revisions, BidRevision{
+		Version:     bid.Version,
+		Name:        bid.Name,
+		Description: bid.Description,
+		Status:      bid.Status,
+	})
+	return revisions, errinfo.Ok()
+}
+
+func sendBid(w http.ResponseWriter, bid *Bid) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bid)
+}
+
+// WithdrawBidHandler cancels a Created or Published bid while its tender is open.
+func WithdrawBidHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req_body withdrawBidRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
+			return
+		}
+		bid, tender, err_info := checkBidAuthor(db, r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		if bid.Status != "Created" && bid.Status != "Published" {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeBidWrongState))
+			return
+		}
+
+		before := *bid
+		bid.Status = StatusCanceled
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := reviseBid(r.Context(), tx, &before, bid, RevisionWithdraw, req_body.Reason); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          r.URL.Query().Get("username"),
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityBid,
+				EntityID:       bid.ID.String(),
+				Action:         audit.ActionBidWithdraw,
+				Before:         before,
+				After:          bid,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		sendBid(w, bid)
+	}
+}
+
+// ResubmitBidHandler publishes a revised version of a withdrawn bid. The bid
+// keeps its ID, earlier versions stay in bids_archive.
+func ResubmitBidHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req_body resubmitBidRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
+			return
+		}
+		bid, tender, err_info := checkBidAuthor(db, r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		if bid.Status != StatusCanceled {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeBidWrongState))
+			return
+		}
+
+		before := *bid
+		bid.Status = "Published"
+		bid.AproveCount = 0
+		if req_body.Name != "" {
+			bid.Name = req_body.Name
+		}
+		if req_body.Description != "" {
+			bid.Description = req_body.Description
+		}
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := reviseBid(r.Context(), tx, &before, bid, RevisionResubmit, req_body.Reason); err_info.Status != 200 {
+				return err_info
+			}
+			if _, err_info := updateAproveCount(r.Context(), tx, bid.ID, 0); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          r.URL.Query().Get("username"),
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityBid,
+				EntityID:       bid.ID.String(),
+				Action:         audit.ActionBidResubmit,
+				Before:         before,
+				After:          bid,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		sendBid(w, bid)
+	}
+}
+
+// RevisionsBidHandler lists all versions of a bid, oldest first, to its
+// author and to the tender organization.
+func RevisionsBidHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bid_id, err_info := helpers.ParseUUID(mux.Vars(r)["bidId"])
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_name := r.URL.Query().Get("username")
+		user_id, err_info := dbhelp.GetUserId(r.Context(), db, user_name)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		bid, err_info := GetBid(r.Context(), db, bid_id)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		is_author, err_info := IsBidAuthor(r.Context(), db, bid, user_id)
+		if err_info.Status == 200 && !is_author {
+			_, err_info = hasUserAccesstoTender(r.Context(), db, user_name, bid.TenderID)
+		}
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		revisions, err_info := getBidRevisions(r.Context(), db, bid)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revisions)
+	}
+}
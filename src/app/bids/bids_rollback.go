@@ -1,20 +1,19 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
-	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
-func getArchivedBid(db *sql.DB, current_bid *Bid, version int) (bid *Bid, err_info errinfo.ErrorInfo) {
-	err_info.Status = 200
-	err_info.Reason = errinfo.ErrMessageServer
+func getArchivedBid(ctx context.Context, db *sql.DB, current_bid *Bid, version int) (bid *Bid, err_info errinfo.ErrorInfo) {
 	bid = &Bid{}
 	*bid = *current_bid
 	query := `
@@ -23,9 +22,9 @@ func getArchivedBid(db *sql.DB, current_bid *Bid, version int) (bid *Bid, err_in
     WHERE t.id = $1 AND t.version = $2
     `
 
-	rows, err := db.Query(query, bid.ID, version)
+	rows, err := db.QueryContext(ctx, query, bid.ID, version)
 	if err != nil {
-		err_info.Status = dbhelp.SqlErrToStatus(err, 500)
+		err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		return
 	}
 	defer rows.Close()
@@ -33,32 +32,26 @@ func getArchivedBid(db *sql.DB, current_bid *Bid, version int) (bid *Bid, err_in
 	if rows.Next() {
 		err := rows.Scan(&bid.Name, &bid.Description)
 		bid.Version++
-		if err != nil {
-			err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-			return
-		}
+		err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		return
 	}
-	err_info.Status = 404
-	err_info.Reason = "This version of bid does not exist."
+	err_info = errinfo.New(errinfo.CodeBidVersionNotFound)
 	return
 }
 
-func rollbackBid(db *sql.DB, current_bid, old_bid *Bid) errinfo.ErrorInfo {
-	err_info := archiveBid(db, current_bid)
+func rollbackBid(ctx context.Context, db dbhelp.Querier, current_bid, old_bid *Bid) errinfo.ErrorInfo {
+	err_info := archiveBid(ctx, db, current_bid, RevisionRollback, "")
 	if err_info.Status != 200 {
 		return err_info
 	}
-	old_bid.Version++
-	err_info = updateBid(db, old_bid)
+	old_bid.Version = current_bid.Version + 1
+	err_info = updateBid(ctx, db, old_bid)
 	return err_info
 }
 
 func RollbackBidsHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
-		err_info.Status = 200
 		vars := mux.Vars(r)
 		s_bid_id := vars["bidId"]
 		s_version := vars["version"]
@@ -67,35 +60,46 @@ func RollbackBidsHandler(db *sql.DB) http.HandlerFunc {
 
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
-			log.Println("errr1")
 			return
 		}
 		if tmp_err_info.Status != 200 {
 			errinfo.SendHttpErr(w, tmp_err_info)
-			log.Println("errr1")
 			return
 		}
-		current_bid, err_info := getBid(db, bid_id)
+		current_bid, err_info := GetBid(r.Context(), db, bid_id)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
-			log.Println("errr1")
 			return
 		}
 
 		user_name := r.URL.Query().Get("username")
-		err_info = hasUserAccesstoTender(db, user_name, current_bid.TenderID)
-		old_bid := &Bid{}
-		*old_bid = *current_bid
-		old_bid, err_info = getArchivedBid(db, current_bid, version)
+		tender, err_info := hasUserRightOnTender(r.Context(), db, user_name, current_bid.TenderID)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		old_bid, err_info := getArchivedBid(r.Context(), db, current_bid, version)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
-			log.Println("errr1")
 			return
 		}
-		err_info = rollbackBid(db, current_bid, old_bid)
+		before := *current_bid
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := rollbackBid(r.Context(), tx, current_bid, old_bid); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityBid,
+				EntityID:       current_bid.ID.String(),
+				Action:         audit.ActionBidRollback,
+				Before:         before,
+				After:          old_bid,
+			})
+		})
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
-			log.Println("errr1")
 			return
 		}
 
@@ -1,12 +1,14 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
-	"log"
+	"go_server/m/logging"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -14,57 +16,72 @@ import (
 )
 
 func handlePutBidStatus(db *sql.DB, w http.ResponseWriter, r *http.Request, bid_id uuid.UUID) {
-	var err_info errinfo.ErrorInfo
 	user_name := r.URL.Query().Get("username")
 	new_status := r.URL.Query().Get("status")
-	if user_name == "" || !helpers.IsNewStatusOk(new_status) {
-		err_info.Status = 400
-		err_info.Reason = errinfo.ErrMessageWrongRequest
+	err_info := errinfo.New(errinfo.CodeValidationFailed)
+	if user_name == "" {
+		err_info = err_info.WithField("username", "Required.")
+	}
+	if !helpers.IsNewStatusOk(new_status) {
+		err_info = err_info.WithField("status", "Must be one of Created, Published, Closed.")
+	}
+	if len(err_info.Fields) != 0 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
 
-	bid, err_info := getBid(db, bid_id)
+	bid, err_info := GetBid(r.Context(), db, bid_id)
 	if err_info.Status != 200 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
-	err_info = hasUserAccesstoTender(db, user_name, bid.TenderID)
+	tender, err_info := hasUserRightOnTender(r.Context(), db, user_name, bid.TenderID)
 	if err_info.Status != 200 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
 
-	new_status, err_info = updateBidStatus(db, bid_id, new_status)
+	before := *bid
+	err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+		var err_info errinfo.ErrorInfo
+		if bid.Status, err_info = updateBidStatus(r.Context(), tx, bid_id, new_status); err_info.Status != 200 {
+			return err_info
+		}
+		return audit.Record(tx, r, audit.Event{
+			Actor:          user_name,
+			OrganizationID: tender.OrganizationID,
+			EntityType:     audit.EntityBid,
+			EntityID:       bid.ID.String(),
+			Action:         audit.ActionBidStatus,
+			Before:         before,
+			After:          bid,
+		})
+	})
 	if err_info.Status != 200 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
-	bid.Status = new_status
 	json.NewEncoder(w).Encode(bid)
 }
 
 func handleGetBidStatus(db *sql.DB, w http.ResponseWriter, r *http.Request, bid_id uuid.UUID) {
-	var err_info errinfo.ErrorInfo
 	user_name := r.URL.Query().Get("username")
 
-	bid, err_info := getBid(db, bid_id)
+	bid, err_info := GetBid(r.Context(), db, bid_id)
 	if err_info.Status != 200 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
-	err_info = hasUserAccesstoTender(db, user_name, bid.TenderID)
+	_, err_info = hasUserAccesstoTender(r.Context(), db, user_name, bid.TenderID)
 	if err_info.Status != 200 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
 
-	w.Write([]byte(bid.Status))
+	json.NewEncoder(w).Encode(bid.Status)
 }
 
-func updateBidStatus(db *sql.DB, bid_id uuid.UUID, status string) (string, errinfo.ErrorInfo) {
-	var err_info errinfo.ErrorInfo
-	err_info.Status = 200
+func updateBidStatus(ctx context.Context, db dbhelp.Querier, bid_id uuid.UUID, status string) (string, errinfo.ErrorInfo) {
 	query := `
 		UPDATE bids
 		SET status = $1
@@ -73,10 +90,9 @@ func updateBidStatus(db *sql.DB, bid_id uuid.UUID, status string) (string, errin
 	`
 
 	var updatedStatus string
-	err := db.QueryRow(query, status, bid_id).Scan(&updatedStatus)
-	if err != nil {
-		err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-		err_info.Reason = errinfo.ErrMessageServer
+	err := db.QueryRowContext(ctx, query, status, bid_id).Scan(&updatedStatus)
+	err_info := dbhelp.SqlErrToErrInfo(err, errinfo.CodeBidNotFound)
+	if err_info.Status != 200 {
 		return "", err_info
 	}
 
@@ -86,8 +102,6 @@ func updateBidStatus(db *sql.DB, bid_id uuid.UUID, status string) (string, errin
 func StatusBidsHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
-		err_info.Status = 200
 		vars := mux.Vars(r)
 		s_bid_id := vars["bidId"]
 		w.Header().Set("Content-Type", "application/json")
@@ -97,7 +111,7 @@ func StatusBidsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		log.Println("status handling ", s_bid_id)
+		logging.FromRequest(r).Debug("bid status", "bid_id", s_bid_id)
 
 		if r.Method == http.MethodGet {
 			handleGetBidStatus(db, w, r, bid_id)
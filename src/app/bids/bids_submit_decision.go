@@ -1,127 +1,148 @@
 package bids
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
-	"log"
+	"go_server/m/logging"
+	"go_server/m/metrics"
+	"go_server/m/tenders"
 	"net/http"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-func checkSubmitDecisionParams(db *sql.DB, r *http.Request) (bid *Bid, err_info errinfo.ErrorInfo) {
-	err_info.Init(200, "Ok")
+func checkSubmitDecisionParams(db *sql.DB, r *http.Request) (bid *Bid, tender *tenders.Tender, err_info errinfo.ErrorInfo) {
 	bid = &Bid{}
 	vars := mux.Vars(r)
 	s_bid_id := vars["bidId"]
 	user_name := r.URL.Query().Get("username")
 	decision := r.URL.Query().Get("decision")
-	log.Println("user", user_name)
 	if decision != "Approved" && decision != "Rejected" {
-		log.Println("Wrong decision")
-		err_info.Status = 400
-		err_info.Reason = errinfo.ErrMessageWrongRequest
+		err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("decision", "Must be Approved or Rejected.")
 		return
 	}
 
 	bid_id, err_info := helpers.ParseUUID(s_bid_id)
 	if err_info.Status != 200 {
-		log.Println("ID not numb")
 		return
 	}
-	bid, err_info = getBid(db, bid_id)
+	bid, err_info = GetBid(r.Context(), db, bid_id)
 	if err_info.Status != 200 {
-		log.Println("NO BID", bid_id)
+		logging.FromRequest(r).Debug("bid not found", "bid_id", bid_id)
 		return
 	}
 
-	err_info = hasUserAccesstoTender(db, user_name, bid.TenderID)
-	log.Println("user", user_name)
+	tender, err_info = hasUserRightOnTender(r.Context(), db, user_name, bid.TenderID)
 	if err_info.Status != 200 {
 		return
 	}
+	if bid.Status == StatusCanceled {
+		err_info = errinfo.New(errinfo.CodeBidWrongState)
+	}
 
 	return
 }
 
-func getResponsibleCount(db *sql.DB, tender_id uuid.UUID) (count int, err_info errinfo.ErrorInfo) {
+// getResponsibleCount counts the employees who may decide on the bids of
+// the tender: those of its organization and of the co-owners having
+// tenders.RightBids.
+func getResponsibleCount(ctx context.Context, db dbhelp.Querier, tender_id uuid.UUID) (count int, err_info errinfo.ErrorInfo) {
 
-	err_info.Init(200, "Ok")
 	count = 0
 	query := `
-		SELECT COUNT(*) 
-		FROM tenders t
-		JOIN organization_responsible or ON t.organization_id = or.organization_id
-		WHERE t.id = $1
-
+		SELECT COUNT(DISTINCT orgr.user_id)
+		FROM organization_responsible orgr
+		WHERE orgr.organization_id IN (
+			SELECT t.organization_id FROM tenders t WHERE t.id = $1
+			UNION
+			SELECT o.organization_id FROM tender_owners o WHERE o.tender_id = $1 AND 'bids' = ANY (o.rights)
+		)
 	`
 
-	err := db.QueryRow(query, tender_id).Scan(&count)
-	if err != nil {
-		err_info.Status = dbhelp.SqlErrToStatus(err, http.StatusInternalServerError)
-		if err_info.Status != 200 {
-			err_info.Reason = errinfo.ErrMessageServer
-		}
-		return count, err_info
-	}
-
+	err := db.QueryRowContext(ctx, query, tender_id).Scan(&count)
+	err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 	return count, err_info
 
 }
 
-func updateAproveCount(db *sql.DB, bid_id uuid.UUID, count int) (int, errinfo.ErrorInfo) {
-	var err_info errinfo.ErrorInfo
-	err_info.Status = 200
+func updateAproveCount(ctx context.Context, db dbhelp.Querier, bid_id uuid.UUID, count int) (int, errinfo.ErrorInfo) {
 	query := `
 		UPDATE bids
 		SET approve_count = $1
 		WHERE id = $2
-		RETURNING status
+		RETURNING approve_count
 	`
 
-	err := db.QueryRow(query, count, bid_id).Scan(&count)
-	if err != nil {
-		err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-		err_info.Reason = errinfo.ErrMessageServer
-		return count, err_info
-	}
+	err := db.QueryRowContext(ctx, query, count, bid_id).Scan(&count)
+	return count, dbhelp.SqlErrToErrInfo(err, errinfo.CodeBidNotFound)
+}
 
-	return count, err_info
+// approveBid counts the approval and publishes the bid once quorum
+// responsible employees, or all of them if there are fewer, approved it.
+func approveBid(ctx context.Context, db dbhelp.Querier, bid *Bid, quorum int) errinfo.ErrorInfo {
+	resp_count, err_info := getResponsibleCount(ctx, db, bid.TenderID)
+	if err_info.Status != 200 {
+		return err_info
+	}
+	bid.AproveCount++
+	if _, err_info = updateAproveCount(ctx, db, bid.ID, bid.AproveCount); err_info.Status != 200 {
+		return err_info
+	}
+	if bid.AproveCount >= min(quorum, resp_count) {
+		_, err_info = updateBidStatus(ctx, db, bid.ID, "Published")
+	}
+	return err_info
 }
 
-func SubmitDecisionHandler(db *sql.DB) http.HandlerFunc {
+// SubmitDecisionHandler closes a rejected bid or counts the approval, see
+// approveBid. The employees of every owner with tenders.RightBids count.
+func SubmitDecisionHandler(db *sql.DB, quorum int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decision := r.URL.Query().Get("decision")
-		bid, err_info := checkSubmitDecisionParams(db, r)
+		bid, tender, err_info := checkSubmitDecisionParams(db, r)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
-		if decision == "Rejected" {
-			updateBidStatus(db, bid.ID, "Closed")
-		} else if bid.Status != "Closed" {
-			resp_count, err_info := getResponsibleCount(db, bid.TenderID)
-			if err_info.Status != 200 {
-				errinfo.SendHttpErr(w, err_info)
-				return
+		before := *bid
+		var after *Bid
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			*bid = before
+			var err_info errinfo.ErrorInfo
+			if decision == "Rejected" {
+				_, err_info = updateBidStatus(r.Context(), tx, bid.ID, "Closed")
+			} else if bid.Status != "Closed" {
+				err_info = approveBid(r.Context(), tx, bid, quorum)
 			}
-			bid.AproveCount++
-			_, err_info = updateAproveCount(db, bid.ID, bid.AproveCount)
 			if err_info.Status != 200 {
-				errinfo.SendHttpErr(w, err_info)
-				return
+				return err_info
 			}
-			if bid.AproveCount >= min(3, resp_count) {
-				updateBidStatus(db, bid.ID, "Published")
-			}
-			if err_info.Status != 200 {
-				errinfo.SendHttpErr(w, err_info)
-				return
+			if after, err_info = GetBid(r.Context(), tx, bid.ID); err_info.Status != 200 {
+				return err_info
 			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          r.URL.Query().Get("username"),
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityBid,
+				EntityID:       bid.ID.String(),
+				Action:         audit.ActionBidDecision,
+				Before:         before,
+				After:          decisionState{Bid: after, Decision: decision},
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
 		}
+		metrics.BidDecisions.WithLabelValues(decision).Inc()
 
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(after)
 	}
 }
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go_server/m/metrics"
+
+	"github.com/lib/pq"
+)
+
+// channel is the Postgres notification channel on which invalidated keys
+// are announced to every process, see Listen.
+const channel = "cache_invalidation"
+
+// clearAll announced on the channel clears the whole cache.
+const clearAll = "*"
+
+// generationStripes is how many generation counters the keys share. Keys
+// of one stripe only make each other's Puts skip more often.
+const generationStripes = 256
+
+// Cache is a read-through cache of rows that change rarely. Values are
+// encoded with gob, so every field is kept whatever its JSON tag.
+type Cache struct {
+	store Store
+	ttl   time.Duration
+	// db announces invalidations; nil only in tests.
+	db *sql.DB
+	// mu orders Puts with the invalidations, which bump the generations
+	// of their keys, see Generation.
+	mu          sync.Mutex
+	generations [generationStripes]uint64
+}
+
+// New returns a cache keeping values in store for at most ttl. A nil store
+// disables caching.
+func New(store Store, ttl time.Duration, db *sql.DB) *Cache {
+	return &Cache{store: store, ttl: ttl, db: db}
+}
+
+var shared = New(nil, 0, nil)
+
+// SetShared is called at startup, before the database is used.
+func SetShared(c *Cache) {
+	shared = c
+}
+
+// Enabled tells whether values are kept between requests.
+func Enabled() bool {
+	return shared.store != nil
+}
+
+// Get returns the cached value of key. Store errors are logged and read as
+// a miss, so the caller falls back to the database.
+func Get[T any](ctx context.Context, key string) (value T, ok bool) {
+	c := shared
+	if c.store == nil {
+		return value, false
+	}
+	data, ok, err := c.store.Get(ctx, key)
+	if err == nil && ok {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	}
+	if err != nil {
+		slog.Warn("cache: can't read", "key", key, "err", err)
+		ok = false
+	}
+	if ok {
+		metrics.CacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		metrics.CacheLookups.WithLabelValues("miss").Inc()
+	}
+	return value, ok
+}
+
+func stripe(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % generationStripes)
+}
+
+// Generation is taken before reading the value of key from the database
+// and passed to Put. A value read before an invalidation of its key is
+// then not cached.
+func Generation(key string) uint64 {
+	c := shared
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[stripe(key)]
+}
+
+// bump must be called with mu held.
+func (c *Cache) bump(keys ...string) {
+	for _, key := range keys {
+		c.generations[stripe(key)]++
+	}
+}
+
+// Put caches value under key, unless key was invalidated since generation
+// was taken.
+func Put(ctx context.Context, key string, generation uint64, value interface{}) {
+	c := shared
+	if c.store == nil {
+		return
+	}
+	var data bytes.Buffer
+	err := gob.NewEncoder(&data).Encode(value)
+	if err == nil {
+		c.mu.Lock()
+		if c.generations[stripe(key)] == generation {
+			err = c.store.Set(ctx, key, data.Bytes(), c.ttl)
+		}
+		c.mu.Unlock()
+	}
+	if err != nil {
+		slog.Warn("cache: can't write", "key", key, "err", err)
+	}
+}
+
+// Invalidate drops the keys after the rows behind them have changed, here
+// and, through a Postgres notification, in every process that Listens.
+// It must be called once the change is committed.
+func Invalidate(ctx context.Context, keys ...string) {
+	c := shared
+	if c.store == nil {
+		return
+	}
+	// The change is done, a cancelled request must not keep stale values.
+	ctx = context.WithoutCancel(ctx)
+	if err := c.delete(ctx, keys...); err != nil {
+		slog.Error("cache: can't invalidate", "keys", keys, "err", err)
+	}
+	c.announce(ctx, keys...)
+}
+
+func (c *Cache) delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump(keys...)
+	return c.store.Delete(ctx, keys...)
+}
+
+func (c *Cache) clear(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.generations {
+		c.generations[i]++
+	}
+	return c.store.Clear(ctx)
+}
+
+// Clear drops everything, e.g. after rows were changed by a script.
+func Clear(ctx context.Context) {
+	c := shared
+	if c.store == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	if err := c.clear(ctx); err != nil {
+		slog.Error("cache: can't clear", "err", err)
+	}
+	c.announce(ctx, clearAll)
+}
+
+func (c *Cache) announce(ctx context.Context, keys ...string) {
+	if c.db == nil {
+		return
+	}
+	for _, key := range keys {
+		if _, err := c.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, key); err != nil {
+			slog.Error("cache: can't announce invalidation", "key", key, "err", err)
+		}
+	}
+}
+
+// Listen drops the keys that other processes invalidate until ctx is done.
+// A value another process read before the change and cached afterwards is
+// dropped here as well. Notifications sent while the listener was
+// disconnected are lost, so the cache is cleared when it reconnects.
+func Listen(ctx context.Context, dsn string) error {
+	c := shared
+	if c.store == nil {
+		return nil
+	}
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			slog.Warn("cache: invalidation listener disconnected", "err", err)
+		case pq.ListenerEventReconnected:
+			c.clear(context.Background())
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return err
+	}
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification := <-listener.Notify:
+				if notification == nil {
+					continue
+				}
+				if notification.Extra == clearAll {
+					c.clear(ctx)
+				} else {
+					c.delete(ctx, notification.Extra)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	store := NewMemoryStore(2)
+	store.now = func() time.Time { return now }
+
+	store.Set(ctx, "a", []byte("1"), time.Minute)
+	store.Set(ctx, "b", []byte("2"), time.Minute)
+	store.Get(ctx, "a")
+	store.Set(ctx, "c", []byte("3"), time.Minute)
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Error("least recently used value not evicted")
+	}
+	if value, ok, _ := store.Get(ctx, "a"); !ok || string(value) != "1" {
+		t.Errorf("a = %q, %v", value, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := store.Get(ctx, "c"); ok {
+		t.Error("expired value returned")
+	}
+	if store.Len() != 1 {
+		t.Errorf("len = %d after expiry", store.Len())
+	}
+	store.Clear(ctx)
+	if store.Len() != 0 {
+		t.Errorf("len = %d after clear", store.Len())
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	store := NewRedisStore(client)
+
+	store.Set(ctx, "a", []byte("1"), time.Minute)
+	store.Set(ctx, "b", []byte("2"), time.Minute)
+	client.Set(ctx, "other", "kept", 0)
+	if value, ok, err := store.Get(ctx, "a"); err != nil || !ok || string(value) != "1" {
+		t.Errorf("a = %q, %v, %v", value, ok, err)
+	}
+	store.Delete(ctx, "a")
+	if _, ok, err := store.Get(ctx, "a"); err != nil || ok {
+		t.Errorf("deleted value returned: %v, %v", ok, err)
+	}
+	server.FastForward(time.Minute)
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Error("expired value returned")
+	}
+	store.Set(ctx, "c", []byte("3"), time.Minute)
+	if err := store.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get(ctx, "c"); ok {
+		t.Error("value kept after clear")
+	}
+	if !server.Exists("other") {
+		t.Error("clear deleted a key outside the cache")
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	defer SetShared(shared)
+
+	type row struct {
+		ID   int
+		Name string
+	}
+	SetShared(New(nil, time.Minute, nil))
+	Put(ctx, "row", Generation("row"), row{1, "x"})
+	if _, ok := Get[row](ctx, "row"); ok {
+		t.Error("disabled cache returned a value")
+	}
+
+	SetShared(New(NewMemoryStore(10), time.Minute, nil))
+	Put(ctx, "row", Generation("row"), row{1, "x"})
+	if value, ok := Get[row](ctx, "row"); !ok || value != (row{1, "x"}) {
+		t.Errorf("row = %+v, %v", value, ok)
+	}
+	if _, ok := Get[string](ctx, "row"); ok {
+		t.Error("value decoded as another type")
+	}
+	Invalidate(ctx, "row")
+	if _, ok := Get[row](ctx, "row"); ok {
+		t.Error("invalidated value returned")
+	}
+	Put(ctx, "row", Generation("row"), row{2, "y"})
+	Clear(ctx)
+	if _, ok := Get[row](ctx, "row"); ok {
+		t.Error("value kept after clear")
+	}
+}
+
+// TestStaleRead covers a value read from the database before a concurrent
+// change: its Put after the invalidation must not cache it.
+func TestStaleRead(t *testing.T) {
+	ctx := context.Background()
+	defer SetShared(shared)
+	SetShared(New(NewMemoryStore(10), time.Minute, nil))
+
+	generation := Generation("tender")
+	// Another request changes the row and invalidates it meanwhile.
+	Invalidate(ctx, "tender")
+	Put(ctx, "tender", generation, "old")
+	if value, ok := Get[string](ctx, "tender"); ok {
+		t.Errorf("value read before invalidation cached: %q", value)
+	}
+
+	Put(ctx, "tender", Generation("tender"), "new")
+	if value, ok := Get[string](ctx, "tender"); !ok || value != "new" {
+		t.Errorf("tender = %q, %v", value, ok)
+	}
+
+	// Invalidations from other processes arrive through Listen.
+	generation = Generation("tender")
+	shared.delete(ctx, "tender")
+	Put(ctx, "tender", generation, "old")
+	if _, ok := Get[string](ctx, "tender"); ok {
+		t.Error("value read before a notified invalidation cached")
+	}
+
+	generation = Generation("owners")
+	Clear(ctx)
+	Put(ctx, "owners", generation, "old")
+	if _, ok := Get[string](ctx, "owners"); ok {
+		t.Error("value read before clear cached")
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore shares the cache between replicas, so an invalidation by one
+// of them is seen by all.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client, prefix: "cache:"}
+}
+
+// NewRedisStoreFromURL connects to e.g. redis://localhost:6379/0.
+func NewRedisStoreFromURL(url string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisStore(redis.NewClient(options)), nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return value, err == nil, err
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
+
+func (s *RedisStore) Clear(ctx context.Context) error {
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := s.client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps encoded values by key until they expire or are deleted.
+type Store interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Clear deletes every key, after invalidations may have been missed.
+	Clear(ctx context.Context) error
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore is a least recently used cache of at most size values, kept
+// in the process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *memoryEntry, the most recently used first
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{size: size, order: list.New(), entries: map[string]*list.Element{}, now: time.Now}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if !s.now().Before(entry.expires) {
+		s.remove(element)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &memoryEntry{key: key, value: value, expires: s.now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.size {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if element, ok := s.entries[key]; ok {
+			s.remove(element)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.order.Init()
+	s.entries = map[string]*list.Element{}
+	return nil
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*memoryEntry).key)
+}
+
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+
+	"go_server/m/cache"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/config"
+	"go_server/m/migrations"
+	"go_server/m/tracing"
+)
+
+// cliEnv is what every command shares: the configuration and the database.
+// ctx is cancelled on interrupt, so a long query stops with the command.
+type cliEnv struct {
+	ctx    context.Context
+	cfg    config.Config
+	db     *sql.DB
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	name  string
+	usage string
+	// migrates is set for the commands that apply migrations themselves, the
+	// others refuse to run against an outdated schema.
+	migrates bool
+	run      func(env *cliEnv, flags *flag.FlagSet, args []string) int
+}
+
+// commands lists the subcommands, the first one runs without arguments.
+var commands = []command{
+	{name: "serve", usage: "serve", migrates: true, run: serveCommand},
+	{name: "migrate", usage: "migrate [-status]", migrates: true, run: migrateCommand},
+	{name: "seed", usage: "seed", run: seedCommand},
+	{name: "user add", usage: "user add [-first-name NAME] [-last-name NAME] [-actor NAME] USERNAME", run: userAddCommand},
+	{name: "org add-member", usage: "org add-member [-actor NAME] ORGANIZATION_ID USERNAME", run: orgAddMemberCommand},
+	{name: "tender close-expired", usage: "tender close-expired -older-than DURATION [-actor NAME] [-dry-run]", run: closeExpiredCommand},
+	{name: "import", usage: "import [-mode atomic|best_effort] [-dry-run] FILE.csv|FILE.json", run: importCommand},
+	{name: "export", usage: "export [-format csv|xlsx] [-o FILE] [-limit N] [-offset N] [-username NAME] [-tender ID] tenders|bids|reviews|decisions", run: exportCommand},
+	{name: "verify-audit", usage: "verify-audit", run: verifyAuditCommand},
+}
+
+// findCommand matches the command name at the start of args.
+func findCommand(args []string) (*command, []string) {
+	if len(args) == 0 {
+		return &commands[0], nil
+	}
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) >= len(words) && slices.Equal(args[:len(words)], words) {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, args
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage:")
+	for _, cmd := range commands {
+		fmt.Fprintln(w, "  "+cmd.usage)
+	}
+}
+
+// newFlags returns a flag set that prints the command usage on errors.
+func (cmd *command) newFlags(stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage:", cmd.usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// runCommand waits for the database and runs the command named by args. The
+// exit code is 0 on success, 1 on failure and 2 on a usage error.
+func runCommand(cfg config.Config, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 1 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		printUsage(stdout)
+		return 0
+	}
+	cmd, rest := findCommand(args)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n", strings.Join(args, " "))
+		printUsage(stderr)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	dbhelp.SetRetryPolicy(dbhelp.RetryPolicy{Attempts: cfg.Database.RetryAttempts, Backoff: cfg.Database.RetryBackoff})
+	connector, err := dbhelp.NewConnector(cfg.Database.Conn)
+	if err != nil {
+		fmt.Fprintln(stderr, "database:", err)
+		return 1
+	}
+	db := tracing.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	if err = dbhelp.WaitReady(ctx, db, cfg.Database.StartupTimeout); err != nil {
+		fmt.Fprintln(stderr, "database:", err)
+		return 1
+	}
+	if err = setupCache(cfg, db); err != nil {
+		fmt.Fprintln(stderr, "cache:", err)
+		return 1
+	}
+	env := &cliEnv{ctx: ctx, cfg: cfg, db: db, stdout: stdout, stderr: stderr}
+	if !cmd.migrates {
+		pending, err := migrations.Pending(ctx, db)
+		if err != nil {
+			fmt.Fprintln(stderr, "can't check migrations:", err)
+			return 1
+		}
+		if len(pending) != 0 {
+			fmt.Fprintf(stderr, "migrations %v are pending, run migrate first\n", pending)
+			return 1
+		}
+	}
+	return cmd.run(env, cmd.newFlags(stderr), rest)
+}
+
+// setupCache makes the commands read through the cache and invalidate it, so
+// their changes reach the running servers.
+func setupCache(cfg config.Config, db *sql.DB) error {
+	var store cache.Store
+	switch {
+	case cfg.Cache.RedisURL != "":
+		redis_store, err := cache.NewRedisStoreFromURL(cfg.Cache.RedisURL)
+		if err != nil {
+			return err
+		}
+		store = redis_store
+	case cfg.Cache.Size > 0:
+		store = cache.NewMemoryStore(cfg.Cache.Size)
+	}
+	cache.SetShared(cache.New(store, cfg.Cache.TTL, db))
+	return nil
+}
+
+// parseArgs parses the flags and checks the number of positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string, positional int) bool {
+	if err := flags.Parse(args); err != nil {
+		return false
+	}
+	if flags.NArg() != positional {
+		flags.Usage()
+		return false
+	}
+	return true
+}
+
+func (env *cliEnv) printJSON(value interface{}) {
+	encoder := json.NewEncoder(env.stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// fail reports the error the way the API would describe it and returns 1.
+func (env *cliEnv) fail(err_info errinfo.ErrorInfo) int {
+	fmt.Fprintln(env.stderr, string(err_info.Code)+":", err_info.Reason)
+	for _, field := range err_info.Fields {
+		fmt.Fprintf(env.stderr, "  %s: %s\n", field.Field, field.Message)
+	}
+	return 1
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	_ "embed"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"go_server/m/audit"
+	"go_server/m/bids"
+	"go_server/m/cache"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/export"
+	"go_server/m/migrations"
+	"go_server/m/tenders"
+
+	"github.com/google/uuid"
+)
+
+//go:embed seed.sql
+var seedSQL string
+
+// migrateCommand applies the pending migrations, with -status it only
+// lists them.
+func migrateCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	status := flags.Bool("status", false, "only list the pending migrations")
+	if !parseArgs(flags, args, 0) {
+		return 2
+	}
+	if !*status {
+		if err := migrations.Apply(env.db); err != nil {
+			fmt.Fprintln(env.stderr, "migrations:", err)
+			return 1
+		}
+	}
+	pending, err := migrations.Pending(env.ctx, env.db)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "migrations:", err)
+		return 1
+	}
+	if len(pending) == 0 {
+		fmt.Fprintln(env.stdout, "schema is up to date")
+	}
+	for _, version := range pending {
+		fmt.Fprintln(env.stdout, "pending", version)
+	}
+	return 0
+}
+
+func seedCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	if !parseArgs(flags, args, 0) {
+		return 2
+	}
+	if _, err := env.db.ExecContext(env.ctx, seedSQL); err != nil {
+		return env.fail(dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer))
+	}
+	cache.Clear(env.ctx)
+	fmt.Fprintln(env.stdout, "demo employees and organizations are loaded")
+	return 0
+}
+
+// userAddCommand creates the employee and records it in the audit log.
+func userAddCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	first_name := flags.String("first-name", "", "first name")
+	last_name := flags.String("last-name", "", "last name")
+	actor := flags.String("actor", "admin-cli", "actor of the audit log entry")
+	if !parseArgs(flags, args, 1) {
+		return 2
+	}
+	var employee dbhelp.Employee
+	err_info := dbhelp.InTxInfo(env.ctx, env.db, func(tx *sql.Tx) errinfo.ErrorInfo {
+		employee = dbhelp.Employee{Username: flags.Arg(0), FirstName: *first_name, LastName: *last_name}
+		if err_info := dbhelp.CreateEmployee(env.ctx, tx, &employee); err_info.Status != 200 {
+			return err_info
+		}
+		return audit.Append(env.ctx, tx, "", audit.Event{
+			Actor:      *actor,
+			EntityType: audit.EntityEmployee,
+			EntityID:   strconv.Itoa(employee.ID),
+			Action:     audit.ActionEmployeeCreate,
+			After:      employee,
+		})
+	})
+	if err_info.Status != 200 {
+		return env.fail(err_info)
+	}
+	env.printJSON(employee)
+	return 0
+}
+
+// organizationMember is the audit state of a membership granted by the CLI.
+type organizationMember struct {
+	OrganizationID int    `json:"organizationId"`
+	UserID         int    `json:"userId"`
+	Username       string `json:"username"`
+}
+
+// orgAddMemberCommand makes the employee responsible for the organization and
+// records it in the audit log.
+func orgAddMemberCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	actor := flags.String("actor", "admin-cli", "actor of the audit log entry")
+	if !parseArgs(flags, args, 2) {
+		return 2
+	}
+	organization_id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		flags.Usage()
+		return 2
+	}
+	organization, err_info := dbhelp.GetOrganization(env.ctx, env.db, organization_id)
+	if err_info.Status != 200 {
+		return env.fail(err_info)
+	}
+	user_id, err_info := dbhelp.GetUserId(env.ctx, env.db, flags.Arg(1))
+	if err_info.Status != 200 {
+		return env.fail(err_info)
+	}
+	err_info = dbhelp.InTxInfo(env.ctx, env.db, func(tx *sql.Tx) errinfo.ErrorInfo {
+		if err_info := dbhelp.AddOrganizationResponsible(env.ctx, tx, organization.ID, user_id); err_info.Status != 200 {
+			return err_info
+		}
+		return audit.Append(env.ctx, tx, "", audit.Event{
+			Actor:          *actor,
+			OrganizationID: organization.ID,
+			EntityType:     audit.EntityOrganization,
+			EntityID:       strconv.Itoa(organization.ID),
+			Action:         audit.ActionOrganizationMember,
+			After:          organizationMember{OrganizationID: organization.ID, UserID: user_id, Username: flags.Arg(1)},
+		})
+	})
+	if err_info.Status != 200 {
+		return env.fail(err_info)
+	}
+	dbhelp.InvalidateOrganizations(env.ctx, user_id)
+	fmt.Fprintf(env.stdout, "%s is responsible for %s\n", flags.Arg(1), organization.Name)
+	return 0
+}
+
+// closeExpiredCommand closes the open tenders older than -older-than. The
+// closed tenders are printed as JSON and recorded in the audit log.
+func closeExpiredCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	older_than := flags.Duration("older-than", 0, "close tenders created longer ago than this, e.g. 720h")
+	actor := flags.String("actor", "admin-cli", "actor of the audit log entries")
+	dry_run := flags.Bool("dry-run", false, "only list the tenders")
+	if !parseArgs(flags, args, 0) {
+		return 2
+	}
+	if *older_than <= 0 {
+		flags.Usage()
+		return 2
+	}
+	closed, err_info := tenders.CloseExpired(env.ctx, env.db, time.Now().Add(-*older_than), *actor, *dry_run)
+	if err_info.Status != 200 {
+		return env.fail(err_info)
+	}
+	env.printJSON(closed)
+	return 0
+}
+
+// exportCommand writes the tables of the export endpoints without their
+// access checks, operators see every tender.
+func exportCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	format := flags.String("format", export.FormatCSV, "csv or xlsx")
+	output := flags.String("o", "", "output file, stdout if empty")
+	limit := flags.Int("limit", 0, "at most this many rows, all if 0")
+	offset := flags.Int("offset", 0, "rows to skip")
+	username := flags.String("username", "", "tender author for tenders, bid author for reviews")
+	s_tender_id := flags.String("tender", "", "tender id for bids, reviews and decisions")
+	if !parseArgs(flags, args, 1) {
+		return 2
+	}
+	if (*format != export.FormatCSV && *format != export.FormatXLSX) || *limit < 0 || *offset < 0 {
+		flags.Usage()
+		return 2
+	}
+	sql_limit := sql.NullInt64{Int64: int64(*limit), Valid: *limit > 0}
+
+	var table *export.Table
+	var tender_id uuid.UUID
+	err_info := errinfo.Ok()
+	if slices.Contains([]string{"bids", "reviews", "decisions"}, flags.Arg(0)) {
+		if tender_id, err_info = helpers.ParseUUID(*s_tender_id); err_info.Status != 200 {
+			return env.fail(err_info.WithField("tender", "Required for "+flags.Arg(0)+"."))
+		}
+	}
+	switch flags.Arg(0) {
+	case "tenders":
+		var user_id int
+		if user_id, err_info = dbhelp.GetUserId(env.ctx, env.db, *username); err_info.Status == 200 {
+			table, err_info = tenders.UserTendersTable(env.ctx, env.db, user_id, sql_limit, *offset)
+		}
+	case "bids":
+		table, err_info = bids.BidsTable(env.ctx, env.db, tender_id, sql_limit, *offset)
+	case "reviews":
+		var author_id int
+		if author_id, err_info = dbhelp.GetUserId(env.ctx, env.db, *username); err_info.Status == 200 {
+			table, err_info = bids.ReviewsTable(env.ctx, env.db, tender_id, author_id, sql_limit, *offset)
+		}
+	case "decisions":
+		table, err_info = bids.DecisionsTable(env.ctx, env.db, tender_id, sql_limit, *offset)
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err_info.Status != 200 {
+		return env.fail(err_info)
+	}
+
+	var out io.Writer = env.stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			table.Rows.Close()
+			fmt.Fprintln(env.stderr, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := table.Write(out, *format); err != nil {
+		fmt.Fprintln(env.stderr, "export:", err)
+		if *output != "" {
+			os.Remove(*output)
+		}
+		return 1
+	}
+	return 0
+}
+
+// verifyAuditCommand checks the hash chain of the audit log, the exit code is
+// 1 when it is broken.
+func verifyAuditCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	if !parseArgs(flags, args, 0) {
+		return 2
+	}
+	result, err := audit.Verify(env.ctx, env.db)
+	if err != nil {
+		return env.fail(dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer))
+	}
+	env.printJSON(result)
+	if !result.Valid {
+		return 1
+	}
+	return 0
+}
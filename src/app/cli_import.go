@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go_server/m/tenders"
+)
+
+// importCommand runs the checks of POST /api/tenders/import. The report is
+// printed as JSON; the exit code is 1 when rows failed.
+func importCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	mode := flags.String("mode", tenders.ImportAtomic, "atomic or best_effort")
+	dry_run := flags.Bool("dry-run", false, "only report what would be imported")
+	if !parseArgs(flags, args, 1) {
+		return 2
+	}
+	if *mode != tenders.ImportAtomic && *mode != tenders.ImportBestEffort {
+		flags.Usage()
+		return 2
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(env.stderr, err)
+		return 1
+	}
+	defer file.Close()
+	content_type := "application/json"
+	if strings.EqualFold(filepath.Ext(file.Name()), ".csv") {
+		content_type = "text/csv"
+	}
+	rows, err_info := tenders.ParseImport(content_type, file)
+	if err_info.Status != 200 {
+		return env.fail(err_info)
+	}
+	report, err_info := tenders.ImportTenders(env.ctx, env.db, "", rows, *mode, *dry_run)
+	if err_info.Status != 200 {
+		return env.fail(err_info)
+	}
+	env.printJSON(report)
+	if report.Failed != 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package dbhelp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go_server/m/cache"
+)
+
+// requestCache remembers lookups for the duration of one request, so the
+// middlewares and the handler of a request never load the same user or
+// tender twice.
+type requestCache struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+type cacheKey struct{}
+
+// WithRequestCache returns a context in which CacheGet finds what CachePut
+// stored. Lookups in other contexts, such as those of the CLI, always reach
+// the database.
+func WithRequestCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheKey{}, &requestCache{values: map[string]interface{}{}})
+}
+
+// CacheMiddleware gives every request its own cache.
+func CacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithRequestCache(r.Context())))
+	})
+}
+
+func cacheFrom(ctx context.Context) *requestCache {
+	request_cache, _ := ctx.Value(cacheKey{}).(*requestCache)
+	return request_cache
+}
+
+func CacheGet[T any](ctx context.Context, key string) (value T, ok bool) {
+	request_cache := cacheFrom(ctx)
+	if request_cache == nil {
+		return value, false
+	}
+	request_cache.mu.Lock()
+	defer request_cache.mu.Unlock()
+	value, ok = request_cache.values[key].(T)
+	return value, ok
+}
+
+func CachePut(ctx context.Context, key string, value interface{}) {
+	if request_cache := cacheFrom(ctx); request_cache != nil {
+		request_cache.mu.Lock()
+		request_cache.values[key] = value
+		request_cache.mu.Unlock()
+	}
+}
+
+// CacheForget drops a value the request has just changed.
+func CacheForget(ctx context.Context, key string) {
+	if request_cache := cacheFrom(ctx); request_cache != nil {
+		request_cache.mu.Lock()
+		delete(request_cache.values, key)
+		request_cache.mu.Unlock()
+	}
+}
+
+// The keys of users and organizations are also announced by the triggers
+// of migration 0011, keep them in sync.
+
+func userIdKey(user_name string) string {
+	return "user_id:" + user_name
+}
+
+func userNameKey(user_id int) string {
+	return fmt.Sprintf("user_name:%d", user_id)
+}
+
+func organizationsKey(user_id int) string {
+	return fmt.Sprintf("organizations:%d", user_id)
+}
+
+// CachedUserId returns the id GetUserId would, if the request knows it.
+func CachedUserId(ctx context.Context, user_name string) (int, bool) {
+	return CacheGet[int](ctx, userIdKey(user_name))
+}
+
+// CachedUserName returns the name GetUserName would, if the request knows it.
+func CachedUserName(ctx context.Context, user_id int) (string, bool) {
+	return CacheGet[string](ctx, userNameKey(user_id))
+}
+
+// RememberUser caches the user for GetUserId and GetUserName.
+func RememberUser(ctx context.Context, user_id int, user_name string) {
+	CachePut(ctx, userIdKey(user_name), user_id)
+	CachePut(ctx, userNameKey(user_id), user_name)
+}
+
+// InvalidateOrganizations is called once the user has joined or left an
+// organization. The trigger on organization_responsible announces the
+// change as well, so one made directly in the database stops granting
+// access at once too.
+func InvalidateOrganizations(ctx context.Context, user_id int) {
+	CacheForget(ctx, organizationsKey(user_id))
+	cache.Invalidate(ctx, organizationsKey(user_id))
+}
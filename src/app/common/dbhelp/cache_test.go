@@ -0,0 +1,41 @@
+package dbhelp
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestCache(t *testing.T) {
+	ctx := WithRequestCache(context.Background())
+	RememberUser(ctx, 7, "user1")
+	if user_id, ok := CachedUserId(ctx, "user1"); !ok || user_id != 7 {
+		t.Errorf("CachedUserId = %d, %v", user_id, ok)
+	}
+	if user_name, ok := CachedUserName(ctx, 7); !ok || user_name != "user1" {
+		t.Errorf("CachedUserName = %q, %v", user_name, ok)
+	}
+
+	// Lookups answer from the cache without touching the database.
+	CachePut(ctx, organizationsKey(7), []int{1})
+	if err_info := IsUserInOrganization(ctx, nil, 7, 2); err_info.Status != 403 {
+		t.Errorf("IsUserInOrganization = %+v", err_info)
+	}
+	if user_id, err_info := GetUserId(ctx, nil, "user1"); err_info.Status != 200 || user_id != 7 {
+		t.Errorf("GetUserId = %d, %+v", user_id, err_info)
+	}
+
+	CachePut(ctx, "tender:1", 1)
+	CacheForget(ctx, "tender:1")
+	if _, ok := CacheGet[int](ctx, "tender:1"); ok {
+		t.Error("forgotten value is still cached")
+	}
+	if _, ok := CacheGet[string](ctx, "user_id:user1"); ok {
+		t.Error("value of another type returned")
+	}
+
+	// Without a cache nothing is remembered.
+	RememberUser(context.Background(), 7, "user1")
+	if _, ok := CachedUserId(context.Background(), "user1"); ok {
+		t.Error("cached outside of a request")
+	}
+}
@@ -0,0 +1,132 @@
+package dbhelp
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+
+	"go_server/m/metrics"
+
+	"github.com/lib/pq"
+)
+
+// pqConn is the method set of lib/pq connections that retryConn forwards.
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+	driver.NamedValueChecker
+}
+
+// NewConnector connects to Postgres through lib/pq, retrying transient
+// errors of connecting and of single statements outside transactions:
+//   - a statement Postgres rolled back after a conflict runs again;
+//   - a read on a broken connection is reported as driver.ErrBadConn, so
+//     database/sql runs it again on another connection. Writes are not
+//     retried there since they may have been applied.
+//
+// Transactions are retried as a whole by InTx.
+func NewConnector(dsn string) (driver.Connector, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &retryConnector{connector}, nil
+}
+
+type retryConnector struct {
+	*pq.Connector
+}
+
+func (c *retryConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	policy := retryPolicy
+	for retry := 0; ; retry++ {
+		conn, err := c.Connector.Connect(ctx)
+		if err == nil {
+			return &retryConn{pqConn: conn.(pqConn)}, nil
+		}
+		if retry+1 >= policy.Attempts || !isConnectionError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		metrics.DBRetries.WithLabelValues("connection").Inc()
+		if err := sleep(ctx, policy.delay(retry)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type retryConn struct {
+	pqConn
+	in_tx bool
+}
+
+type retryTx struct {
+	driver.Tx
+	conn *retryConn
+}
+
+func (tx *retryTx) Commit() error {
+	tx.conn.in_tx = false
+	return tx.Tx.Commit()
+}
+
+func (tx *retryTx) Rollback() error {
+	tx.conn.in_tx = false
+	return tx.Tx.Rollback()
+}
+
+func (c *retryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.pqConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.in_tx = true
+	return &retryTx{Tx: tx, conn: c}, nil
+}
+
+func (c *retryConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *retryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return retryStatement(ctx, c, isRead(query), func() (driver.Rows, error) {
+		return c.pqConn.QueryContext(ctx, query, args)
+	})
+}
+
+func (c *retryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return retryStatement(ctx, c, isRead(query), func() (driver.Result, error) {
+		return c.pqConn.ExecContext(ctx, query, args)
+	})
+}
+
+func isRead(query string) bool {
+	query = strings.TrimSpace(query)
+	return len(query) >= 6 && strings.EqualFold(query[:6], "SELECT")
+}
+
+func retryStatement[T any](ctx context.Context, c *retryConn, read bool, run func() (T, error)) (T, error) {
+	policy := retryPolicy
+	for retry := 0; ; retry++ {
+		result, err := run()
+		if err == nil || c.in_tx || ctx.Err() != nil {
+			return result, err
+		}
+		if read && isConnectionError(err) {
+			metrics.DBRetries.WithLabelValues("connection").Inc()
+			return result, driver.ErrBadConn
+		}
+		if !isRolledBack(err) || retry+1 >= policy.Attempts {
+			return result, err
+		}
+		metrics.DBRetries.WithLabelValues("conflict").Inc()
+		if err := sleep(ctx, policy.delay(retry)); err != nil {
+			return result, err
+		}
+	}
+}
@@ -1,31 +1,31 @@
 package dbhelp
 
 import (
+	"context"
 	"database/sql"
+	"go_server/m/cache"
 	"go_server/m/common/errinfo"
+	"log/slog"
 	"net/http"
+	"slices"
 )
 
-func SqlErrToErrInfo(err error, err_status int, message string) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
-	if message != "" {
-		err_info.Reason = message
+// SqlErrToErrInfo maps sql.ErrNoRows to not_found_code, a query stopped by
+// the request deadline to a timeout and any other error to an internal
+// error, which is logged since the client only sees a 500.
+func SqlErrToErrInfo(err error, not_found_code errinfo.ErrorCode) errinfo.ErrorInfo {
+	if err == nil {
+		return errinfo.Ok()
 	}
-	err_info.Status = SqlErrToStatus(err, err_status)
-	return err_info
-}
-
-func SqlErrToStatus(err error, err_status int) int {
-	status := 200
-	if err != nil {
-		if err == sql.ErrNoRows {
-			status = err_status
-		} else {
-			status = 500
-		}
-
+	if err == sql.ErrNoRows {
+		return errinfo.New(not_found_code)
 	}
-	return status
+	if IsCanceled(err) {
+		slog.Warn("database query canceled", "err", err)
+		return errinfo.New(errinfo.CodeTimeout)
+	}
+	slog.Error("database error", "err", err)
+	return errinfo.New(errinfo.CodeServer)
 }
 
 func GetUserNameFromRequest(r *http.Request) string {
@@ -33,63 +33,168 @@ func GetUserNameFromRequest(r *http.Request) string {
 	return username
 }
 
-func GetUserName(db *sql.DB, user_id int) (user_name string, err_info errinfo.ErrorInfo) {
+func GetUserName(ctx context.Context, db *sql.DB, user_id int) (user_name string, err_info errinfo.ErrorInfo) {
+	if user_name, ok := CachedUserName(ctx, user_id); ok {
+		return user_name, errinfo.Ok()
+	}
+	if user_name, ok := cache.Get[string](ctx, userNameKey(user_id)); ok {
+		RememberUser(ctx, user_id, user_name)
+		return user_name, errinfo.Ok()
+	}
+	generation := cache.Generation(userNameKey(user_id))
 	user_name = ""
 	query := `
         SELECT e.username
         FROM  employee e WHERE e.id = $1
 		LIMIT 1
     `
-	err := db.QueryRow(query, user_id).Scan(&user_name)
+	err := db.QueryRowContext(ctx, query, user_id).Scan(&user_name)
 
-	err_info.Status = SqlErrToStatus(err, 401)
-	if err_info.Status != 200 {
-		err_info.Reason = "User does not exist."
+	err_info = SqlErrToErrInfo(err, errinfo.CodeWrongUser)
+	if err_info.Status == 200 {
+		RememberUser(ctx, user_id, user_name)
+		cache.Put(ctx, userNameKey(user_id), generation, user_name)
 	}
 	return
 }
 
-func IsUserExistAndResponsible(db *sql.DB, user_name string, organization_id int) (user_id int, err_info errinfo.ErrorInfo) {
-	user_id, err_info = GetUserId(db, user_name)
+func IsUserExistAndResponsible(ctx context.Context, db *sql.DB, user_name string, organization_id int) (user_id int, err_info errinfo.ErrorInfo) {
+	user_id, err_info = GetUserId(ctx, db, user_name)
 	if err_info.Status != 200 {
 		return
 	}
-	err_info = IsUserInOrganization(db, user_id, organization_id)
+	err_info = IsUserInOrganization(ctx, db, user_id, organization_id)
 	if err_info.Status != 200 {
-		err_info.Status = http.StatusForbidden
-		err_info.Reason = errinfo.ErrMessageNoPermission
+		err_info = errinfo.New(errinfo.CodeNoPermission)
 		return
 	}
 	return
 }
 
-func IsUserInOrganization(db *sql.DB, user_id, organization_id int) errinfo.ErrorInfo {
+func IsUserInOrganization(ctx context.Context, db *sql.DB, user_id, organization_id int) errinfo.ErrorInfo {
+	organization_ids, err_info := GetUserOrganizations(ctx, db, user_id)
+	if err_info.Status == 200 && !slices.Contains(organization_ids, organization_id) {
+		err_info = errinfo.New(errinfo.CodeNoPermission)
+	}
+	return err_info
+}
 
+// GetUserOrganizations returns the organizations the user is responsible
+// for, read through the shared cache.
+func GetUserOrganizations(ctx context.Context, db *sql.DB, user_id int) ([]int, errinfo.ErrorInfo) {
+	if organization_ids, ok := CacheGet[[]int](ctx, organizationsKey(user_id)); ok {
+		return organization_ids, errinfo.Ok()
+	}
+	if organization_ids, ok := cache.Get[[]int](ctx, organizationsKey(user_id)); ok {
+		CachePut(ctx, organizationsKey(user_id), organization_ids)
+		return organization_ids, errinfo.Ok()
+	}
+	generation := cache.Generation(organizationsKey(user_id))
 	query := `
-        SELECT orgr.user_id 
-        FROM organization_responsible orgr 
-        WHERE orgr.user_id = $1 AND orgr.organization_id = $2
-		LIMIT 1
+        SELECT orgr.organization_id
+        FROM organization_responsible orgr
+        WHERE orgr.user_id = $1
+        ORDER BY orgr.organization_id
     `
-	err := db.QueryRow(query, user_id, organization_id).Scan(&user_id)
-	var err_info errinfo.ErrorInfo
-	err_info.Status = SqlErrToStatus(err, 403)
-	err_info.Reason = "User does not have permission."
-	return err_info
+	rows, err := db.QueryContext(ctx, query, user_id)
+	if err != nil {
+		return nil, SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+	organization_ids := []int{}
+	for rows.Next() {
+		var organization_id int
+		if err := rows.Scan(&organization_id); err != nil {
+			return nil, SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		organization_ids = append(organization_ids, organization_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	CachePut(ctx, organizationsKey(user_id), organization_ids)
+	cache.Put(ctx, organizationsKey(user_id), generation, organization_ids)
+	return organization_ids, errinfo.Ok()
 }
 
-func GetUserId(db *sql.DB, user_name string) (user_id int, err_info errinfo.ErrorInfo) {
+func GetUserId(ctx context.Context, db *sql.DB, user_name string) (user_id int, err_info errinfo.ErrorInfo) {
+	if user_id, ok := CachedUserId(ctx, user_name); ok {
+		return user_id, errinfo.Ok()
+	}
+	if user_id, ok := cache.Get[int](ctx, userIdKey(user_name)); ok {
+		RememberUser(ctx, user_id, user_name)
+		return user_id, errinfo.Ok()
+	}
+	generation := cache.Generation(userIdKey(user_name))
 	query := `
-        SELECT e.id 
+        SELECT e.id
         FROM  employee e WHERE e.username = $1
 		LIMIT 1
     `
-	err := db.QueryRow(query, user_name).Scan(&user_id)
+	err := db.QueryRowContext(ctx, query, user_name).Scan(&user_id)
 
-	err_info.Status = SqlErrToStatus(err, 401)
-	if err_info.Status != 200 {
-		err_info.Reason = "User does not exist."
+	err_info = SqlErrToErrInfo(err, errinfo.CodeWrongUser)
+	if err_info.Status == 200 {
+		RememberUser(ctx, user_id, user_name)
+		cache.Put(ctx, userIdKey(user_name), generation, user_id)
 	}
+	return
+}
 
+// GetUserOrganizationId returns the first organization the user is responsible for.
+func GetUserOrganizationId(ctx context.Context, db *sql.DB, user_name string) (organization_id int, err_info errinfo.ErrorInfo) {
+	query := `
+        SELECT orgr.organization_id
+        FROM organization_responsible orgr
+        JOIN employee e ON e.id = orgr.user_id
+        WHERE e.username = $1
+        ORDER BY orgr.organization_id
+		LIMIT 1
+    `
+	err := db.QueryRowContext(ctx, query, user_name).Scan(&organization_id)
+	err_info = SqlErrToErrInfo(err, errinfo.CodeNoPermission)
 	return
 }
+
+// CreateEmployee inserts the employee unless the username is taken.
+func CreateEmployee(ctx context.Context, db Querier, employee *Employee) errinfo.ErrorInfo {
+	query := `
+        INSERT INTO employee (username, first_name, last_name)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (username) DO NOTHING
+        RETURNING id, created_at, updated_at
+    `
+	err := db.QueryRowContext(ctx, query, employee.Username, employee.FirstName, employee.LastName).
+		Scan(&employee.ID, &employee.CreatedAt, &employee.UpdatedAt)
+	return SqlErrToErrInfo(err, errinfo.CodeAlreadyExists)
+}
+
+func GetOrganization(ctx context.Context, db *sql.DB, organization_id int) (*Organization, errinfo.ErrorInfo) {
+	query := `
+        SELECT id, name, description, type, created_at, updated_at
+        FROM organization WHERE id = $1
+    `
+	var organization Organization
+	err := db.QueryRowContext(ctx, query, organization_id).Scan(&organization.ID, &organization.Name, &organization.Description,
+		&organization.Type, &organization.CreatedAt, &organization.UpdatedAt)
+	if err != nil {
+		return nil, SqlErrToErrInfo(err, errinfo.CodeOrganizationNotFound)
+	}
+	return &organization, errinfo.Ok()
+}
+
+// AddOrganizationResponsible makes the user responsible for the organization
+// unless they already are. Call InvalidateOrganizations once it is committed.
+func AddOrganizationResponsible(ctx context.Context, db Querier, organization_id, user_id int) errinfo.ErrorInfo {
+	query := `
+        INSERT INTO organization_responsible (organization_id, user_id)
+        SELECT $1, $2
+        WHERE NOT EXISTS (
+            SELECT 1 FROM organization_responsible WHERE organization_id = $1 AND user_id = $2
+        )
+        RETURNING id
+    `
+	var id int
+	err := db.QueryRowContext(ctx, query, organization_id, user_id).Scan(&id)
+	return SqlErrToErrInfo(err, errinfo.CodeAlreadyExists)
+}
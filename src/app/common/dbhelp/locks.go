@@ -0,0 +1,14 @@
+package dbhelp
+
+// Postgres advisory lock keys. All users of the database share one key
+// space, so every lock of the service is defined here and nowhere else.
+// The values are arbitrary but must never change: replicas of different
+// versions running side by side have to take the same locks.
+const (
+	// LockMigrations serializes migrations.Apply between replicas starting
+	// at the same time.
+	LockMigrations int64 = 30030
+	// LockAuditChain serializes the audit log writers, so that every entry
+	// is chained to the latest one.
+	LockAuditChain int64 = 26026
+)
@@ -0,0 +1,155 @@
+package dbhelp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"go_server/m/metrics"
+
+	"github.com/lib/pq"
+)
+
+// RetryPolicy bounds the retries of transient database errors: Attempts
+// tries in total, waiting Backoff before the second one and twice as long
+// before each next one.
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+const maxBackoff = 5 * time.Second
+
+var retryPolicy = RetryPolicy{Attempts: 3, Backoff: 50 * time.Millisecond}
+
+// SetRetryPolicy is called at startup, before the database is used.
+func SetRetryPolicy(policy RetryPolicy) {
+	retryPolicy = policy
+}
+
+// delay returns the wait before the retry-th retry, with jitter so that
+// conflicting requests do not retry in lockstep.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.Backoff << retry
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRolledBack tells that Postgres aborted the statement because of a
+// conflict with another transaction, so running it again is safe.
+func isRolledBack(err error) bool {
+	var pq_err *pq.Error
+	if !errors.As(err, &pq_err) {
+		return false
+	}
+	switch pq_err.Code {
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return true
+	}
+	return false
+}
+
+// isConnectionError tells that the connection broke or could not be made.
+// Whether the statement ran is then unknown.
+func isConnectionError(err error) bool {
+	var pq_err *pq.Error
+	if errors.As(err, &pq_err) {
+		switch pq_err.Code.Class() {
+		case "08", "57": // connection_exception, operator_intervention
+			return pq_err.Code != "57014" // query_canceled
+		}
+		return pq_err.Code == "53300" // too_many_connections
+	}
+	var net_err net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &net_err)
+}
+
+// IsCanceled tells that the statement stopped because its context ended,
+// either by a request deadline or by the client going away.
+func IsCanceled(err error) bool {
+	var pq_err *pq.Error
+	if errors.As(err, &pq_err) {
+		return pq_err.Code == "57014" // query_canceled
+	}
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// IsTransient tells whether the same operation may succeed when retried.
+func IsTransient(err error) bool {
+	return err != nil && (isRolledBack(err) || isConnectionError(err))
+}
+
+func retryReason(err error) string {
+	if isRolledBack(err) {
+		return "conflict"
+	}
+	return "connection"
+}
+
+// InTx runs fn in a transaction and commits it, running it again from the
+// start when the transaction fails with a transient error. A failed commit
+// is not retried because it may have been applied.
+func InTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	policy := retryPolicy
+	for retry := 0; ; retry++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err == nil {
+			if err = fn(tx); err == nil {
+				return tx.Commit()
+			}
+			tx.Rollback()
+		}
+		if retry+1 >= policy.Attempts || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		metrics.DBRetries.WithLabelValues(retryReason(err)).Inc()
+		slog.Warn("database: retrying transaction", "err", err, "retry", retry+1)
+		if err := sleep(ctx, policy.delay(retry)); err != nil {
+			return err
+		}
+	}
+}
+
+// WaitReady pings the database with exponential backoff until it answers
+// or timeout passes, so the service can start before Postgres does. Errors
+// that waiting does not fix, such as a wrong password, fail at once.
+func WaitReady(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for retry := 0; ; retry++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if !IsTransient(err) && ctx.Err() == nil {
+			return err
+		}
+		slog.Warn("database: not ready", "err", err, "attempt", retry+1)
+		if sleep(ctx, retryPolicy.delay(retry+2)) != nil {
+			return fmt.Errorf("not ready after %s: %w", timeout, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package dbhelp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"go_server/m/common/errinfo"
+
+	"github.com/lib/pq"
+)
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pq.Error{Code: "57014"}, false},
+		{&pq.Error{Code: "23505"}, false},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{driver.ErrBadConn, true},
+		{context.Canceled, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := IsTransient(c.err); got != c.want {
+			t.Errorf("IsTransient(%v) = %v", c.err, got)
+		}
+	}
+}
+
+func TestSqlErrToErrInfo(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{nil, 200},
+		{sql.ErrNoRows, 404},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), 504},
+		{&pq.Error{Code: "57014"}, 504},
+		{&pq.Error{Code: "23505"}, 500},
+	}
+	for _, c := range cases {
+		if got := SqlErrToErrInfo(c.err, errinfo.CodeTenderNotFound); got.Status != c.want {
+			t.Errorf("SqlErrToErrInfo(%v) = %d", c.err, got.Status)
+		}
+	}
+}
+
+func TestRetryStatement(t *testing.T) {
+	SetRetryPolicy(RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	ctx := context.Background()
+	calls := 0
+	conflict := func() (int, error) {
+		if calls++; calls < 3 {
+			return 0, &pq.Error{Code: "40001"}
+		}
+		return 1, nil
+	}
+	if result, err := retryStatement(ctx, &retryConn{}, false, conflict); err != nil || result != 1 || calls != 3 {
+		t.Errorf("conflict: %d, %v after %d calls", result, err, calls)
+	}
+
+	calls = 0
+	if _, err := retryStatement(ctx, &retryConn{in_tx: true}, false, conflict); err == nil || calls != 1 {
+		t.Errorf("conflict in a transaction retried %d times", calls)
+	}
+
+	reset := func() (int, error) {
+		calls++
+		return 0, &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+	}
+	calls = 0
+	if _, err := retryStatement(ctx, &retryConn{}, true, reset); !errors.Is(err, driver.ErrBadConn) || calls != 1 {
+		t.Errorf("read on a broken connection: %v", err)
+	}
+	if _, err := retryStatement(ctx, &retryConn{}, false, reset); errors.Is(err, driver.ErrBadConn) {
+		t.Error("write on a broken connection is retried")
+	}
+}
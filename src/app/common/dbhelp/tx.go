@@ -0,0 +1,35 @@
+package dbhelp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go_server/m/common/errinfo"
+)
+
+// Querier runs statements on a *sql.DB or within a *sql.Tx, so that a
+// mutation can be part of a larger transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var errTxFailed = errors.New("transaction failed")
+
+// InTxInfo is InTx for a function reporting an errinfo.ErrorInfo: a status
+// other than 200 rolls the transaction back and is returned as is.
+func InTxInfo(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) errinfo.ErrorInfo) errinfo.ErrorInfo {
+	var err_info errinfo.ErrorInfo
+	err := InTx(ctx, db, func(tx *sql.Tx) error {
+		if err_info = fn(tx); err_info.Status != 200 {
+			return errTxFailed
+		}
+		return nil
+	})
+	if err == errTxFailed {
+		return err_info
+	}
+	return SqlErrToErrInfo(err, errinfo.CodeServer)
+}
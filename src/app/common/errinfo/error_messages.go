@@ -1,34 +1,231 @@
 package errinfo
 
 import (
-	"fmt"
+	"encoding/json"
 	"net/http"
+
+	"go_server/m/common/requestid"
+)
+
+type ErrorCode string
+
+const (
+	CodeOk                    ErrorCode = "ok"
+	CodeWrongRequest          ErrorCode = "wrong_request"
+	CodeValidationFailed      ErrorCode = "validation_failed"
+	CodeInvalidNumber         ErrorCode = "invalid_number"
+	CodeInvalidTime           ErrorCode = "invalid_time"
+	CodeWrongUser             ErrorCode = "wrong_user"
+	CodeUnauthorized          ErrorCode = "unauthorized"
+	CodeNoPermission          ErrorCode = "no_permission"
+	CodeNotTenderAuthor       ErrorCode = "not_tender_author"
+	CodeTenderNotFound        ErrorCode = "tender_not_found"
+	CodeTenderVersionNotFound ErrorCode = "tender_version_not_found"
+	CodeBidNotFound           ErrorCode = "bid_not_found"
+	CodeBidVersionNotFound    ErrorCode = "bid_version_not_found"
+	CodeNotBidAuthor          ErrorCode = "not_bid_author"
+	CodeOwnTender             ErrorCode = "own_tender"
+	CodeBidWrongState         ErrorCode = "bid_wrong_state"
+	CodeTenderClosed          ErrorCode = "tender_closed"
+	CodeTenderNotPublished    ErrorCode = "tender_not_published"
+	CodeQuestionNotFound      ErrorCode = "question_not_found"
+	CodeQuestionAnswered      ErrorCode = "question_answered"
+	CodeNotificationNotFound  ErrorCode = "notification_not_found"
+	CodeQualificationNotFound ErrorCode = "qualification_not_found"
+	CodeQualificationReviewed ErrorCode = "qualification_reviewed"
+	CodeNotQualified          ErrorCode = "not_qualified"
+	CodeAttachmentNotFound    ErrorCode = "attachment_not_found"
+	CodeAttachmentTooLarge    ErrorCode = "attachment_too_large"
+	CodeAttachmentType        ErrorCode = "attachment_type_not_allowed"
+	CodeReviewsNotFound       ErrorCode = "reviews_not_found"
+	CodeOrganizationNotFound  ErrorCode = "organization_not_found"
+	CodeAlreadyExists         ErrorCode = "already_exists"
+	CodeNotFound              ErrorCode = "not_found"
+	CodeMethodNotAllowed      ErrorCode = "method_not_allowed"
+	CodeRateLimited           ErrorCode = "rate_limited"
+	CodeIdempotencyKeyReused  ErrorCode = "idempotency_key_reused"
+	CodeIdempotencyInProgress ErrorCode = "idempotency_in_progress"
+	CodeTimeout               ErrorCode = "timeout"
+	CodeServer                ErrorCode = "internal_error"
+	CodeResponseInvalid       ErrorCode = "response_invalid"
 )
 
 const (
-	ErrMessageWrongUser        = "Incorrect username or user does not exist."
-	ErrMessageNoPermission     = "User does not have permission."
-	ErrMessageServer           = "Something went wrong. Please try again."
-	ErrMessageWrongRequest     = "The request format or parameters are incorrect."
-	ErrMessageMethodNotAllowed = "Method not allowed"
-	ErrMessageTenderNotFound   = "Tender not Found"
-	ErrMessageBidNotFound      = "Bid not Found"
+	ErrMessageWrongRequest          = "The request format or parameters are incorrect."
+	ErrMessageValidationFailed      = "Some fields of the request are invalid."
+	ErrMessageInvalidNumber         = "Parametr must be positive number."
+	ErrMessageInvalidTime           = "Time must be in RFC3339 format."
+	ErrMessageWrongUser             = "Incorrect username or user does not exist."
+	ErrMessageUnauthorized          = "Missing or invalid API key."
+	ErrMessageNoPermission          = "User does not have permission."
+	ErrMessageNotTenderAuthor       = "User is not tender author."
+	ErrMessageTenderNotFound        = "Tender not Found"
+	ErrMessageTenderVersionNotFound = "This version of tender does not exist."
+	ErrMessageBidNotFound           = "Bid not Found"
+	ErrMessageBidVersionNotFound    = "This version of bid does not exist."
+	ErrMessageNotBidAuthor          = "User is not bid author."
+	ErrMessageOwnTender             = "Can not bid on a tender of its own organization."
+	ErrMessageBidWrongState         = "Bid status does not allow this action."
+	ErrMessageTenderClosed          = "Tender is closed."
+	ErrMessageTenderNotPublished    = "Tender is not published."
+	ErrMessageQuestionNotFound      = "Question not found."
+	ErrMessageQuestionAnswered      = "Question is already answered."
+	ErrMessageNotificationNotFound  = "Notification not found."
+	ErrMessageQualificationNotFound = "Qualification not found."
+	ErrMessageQualificationReviewed = "Qualification is already reviewed."
+	ErrMessageNotQualified          = "Supplier is not qualified for the service type of the tender."
+	ErrMessageAttachmentNotFound    = "Attachment not found."
+	ErrMessageAttachmentTooLarge    = "Attachment exceeds the size limit."
+	ErrMessageAttachmentType        = "Attachment type is not allowed or does not match the content."
+	ErrMessageReviewsNotFound       = "Reviews not found."
+	ErrMessageOrganizationNotFound  = "Organization not found."
+	ErrMessageAlreadyExists         = "Resource already exists."
+	ErrMessageNotFound              = "Resource not found."
+	ErrMessageMethodNotAllowed      = "Method not allowed"
+	ErrMessageRateLimited           = "Too many requests, retry later."
+	ErrMessageIdempotencyKeyReused  = "Idempotency key was already used with another request."
+	ErrMessageIdempotencyInProgress = "A request with this idempotency key is still being processed."
+	ErrMessageTimeout               = "The request took too long. Please try again later."
+	ErrMessageServer                = "Something went wrong. Please try again."
+	ErrMessageResponseInvalid       = "Response does not match the API specification."
 )
 
+type problemType struct {
+	status int
+	title  string
+}
+
+var problemTypes = map[ErrorCode]problemType{
+	CodeOk:                    {http.StatusOK, "Ok"},
+	CodeWrongRequest:          {http.StatusBadRequest, ErrMessageWrongRequest},
+	CodeValidationFailed:      {http.StatusBadRequest, ErrMessageValidationFailed},
+	CodeInvalidNumber:         {http.StatusBadRequest, ErrMessageInvalidNumber},
+	CodeInvalidTime:           {http.StatusBadRequest, ErrMessageInvalidTime},
+	CodeWrongUser:             {http.StatusUnauthorized, ErrMessageWrongUser},
+	CodeUnauthorized:          {http.StatusUnauthorized, ErrMessageUnauthorized},
+	CodeNoPermission:          {http.StatusForbidden, ErrMessageNoPermission},
+	CodeNotTenderAuthor:       {http.StatusForbidden, ErrMessageNotTenderAuthor},
+	CodeTenderNotFound:        {http.StatusNotFound, ErrMessageTenderNotFound},
+	CodeTenderVersionNotFound: {http.StatusNotFound, ErrMessageTenderVersionNotFound},
+	CodeBidNotFound:           {http.StatusNotFound, ErrMessageBidNotFound},
+	CodeBidVersionNotFound:    {http.StatusNotFound, ErrMessageBidVersionNotFound},
+	CodeNotBidAuthor:          {http.StatusForbidden, ErrMessageNotBidAuthor},
+	CodeOwnTender:             {http.StatusForbidden, ErrMessageOwnTender},
+	CodeBidWrongState:         {http.StatusConflict, ErrMessageBidWrongState},
+	CodeTenderClosed:          {http.StatusConflict, ErrMessageTenderClosed},
+	CodeTenderNotPublished:    {http.StatusConflict, ErrMessageTenderNotPublished},
+	CodeQuestionNotFound:      {http.StatusNotFound, ErrMessageQuestionNotFound},
+	CodeQuestionAnswered:      {http.StatusConflict, ErrMessageQuestionAnswered},
+	CodeNotificationNotFound:  {http.StatusNotFound, ErrMessageNotificationNotFound},
+	CodeQualificationNotFound: {http.StatusNotFound, ErrMessageQualificationNotFound},
+	CodeQualificationReviewed: {http.StatusConflict, ErrMessageQualificationReviewed},
+	CodeNotQualified:          {http.StatusForbidden, ErrMessageNotQualified},
+	CodeAttachmentNotFound:    {http.StatusNotFound, ErrMessageAttachmentNotFound},
+	CodeAttachmentTooLarge:    {http.StatusRequestEntityTooLarge, ErrMessageAttachmentTooLarge},
+	CodeAttachmentType:        {http.StatusUnsupportedMediaType, ErrMessageAttachmentType},
+	CodeReviewsNotFound:       {http.StatusNotFound, ErrMessageReviewsNotFound},
+	CodeOrganizationNotFound:  {http.StatusNotFound, ErrMessageOrganizationNotFound},
+	CodeAlreadyExists:         {http.StatusConflict, ErrMessageAlreadyExists},
+	CodeNotFound:              {http.StatusNotFound, ErrMessageNotFound},
+	CodeMethodNotAllowed:      {http.StatusMethodNotAllowed, ErrMessageMethodNotAllowed},
+	CodeRateLimited:           {http.StatusTooManyRequests, ErrMessageRateLimited},
+	CodeIdempotencyKeyReused:  {http.StatusUnprocessableEntity, ErrMessageIdempotencyKeyReused},
+	CodeIdempotencyInProgress: {http.StatusConflict, ErrMessageIdempotencyInProgress},
+	CodeTimeout:               {http.StatusGatewayTimeout, ErrMessageTimeout},
+	CodeServer:                {http.StatusInternalServerError, ErrMessageServer},
+	CodeResponseInvalid:       {http.StatusInternalServerError, ErrMessageResponseInvalid},
+}
+
+// FieldError points at a single invalid field of the request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
 type ErrorInfo struct {
 	Status int
 	Reason string
+	Code   ErrorCode
+	Fields []FieldError
 }
 
-func SendHttpErr(w http.ResponseWriter, errorInfo ErrorInfo) {
+// Problem is the RFC 7807 representation of ErrorInfo. Reason duplicates
+// Detail for clients written against the original errorResponse schema.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Reason    string       `json:"reason"`
+}
+
+func New(code ErrorCode) ErrorInfo {
+	problem_type, ok := problemTypes[code]
+	if !ok {
+		problem_type = problemTypes[CodeServer]
+	}
+	return ErrorInfo{Status: problem_type.status, Reason: problem_type.title, Code: code}
+}
+
+func Ok() ErrorInfo {
+	return New(CodeOk)
+}
 
-	jsonResponse := fmt.Sprintf(`{"reason": "%s"}`, errorInfo.Reason)
+// WithField adds a field-level validation detail.
+func (err_info ErrorInfo) WithField(field, message string) ErrorInfo {
+	err_info.Fields = append(err_info.Fields, FieldError{Field: field, Message: message})
+	return err_info
+}
 
-	http.Error(w, jsonResponse, errorInfo.Status)
+// codeFromStatus is used for ErrorInfo values built without a code.
+func codeFromStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeWrongRequest
+	case http.StatusUnauthorized:
+		return CodeWrongUser
+	case http.StatusForbidden:
+		return CodeNoPermission
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	}
+	return CodeServer
+}
 
+func ToProblem(errorInfo ErrorInfo, request_id string) Problem {
+	if errorInfo.Status == 0 {
+		errorInfo.Status = http.StatusInternalServerError
+	}
+	code := errorInfo.Code
+	if code == "" {
+		code = codeFromStatus(errorInfo.Status)
+	}
+	title := errorInfo.Reason
+	if problem_type, ok := problemTypes[code]; ok {
+		title = problem_type.title
+	}
+	return Problem{
+		Type:      "/problems/" + string(code),
+		Title:     title,
+		Status:    errorInfo.Status,
+		Detail:    errorInfo.Reason,
+		Code:      code,
+		RequestID: request_id,
+		Errors:    errorInfo.Fields,
+		Reason:    errorInfo.Reason,
+	}
 }
 
-func (err *ErrorInfo) Init(status int, reason string) {
-	err.Status = status
-	err.Reason = reason
+func SendHttpErr(w http.ResponseWriter, errorInfo ErrorInfo) {
+	problem := ToProblem(errorInfo, w.Header().Get(requestid.Header))
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
 }
@@ -16,14 +16,21 @@ func Atoi(s string) (num int, err_info errinfo.ErrorInfo) {
 	num = 0
 	num, err := strconv.Atoi(s)
 	if err == nil && num >= 0 {
-		err_info.Status = 200
+		err_info = errinfo.Ok()
 		return
 	}
-	err_info.Status = 400
-	err_info.Reason = "Parametr must be positive number."
+	err_info = errinfo.New(errinfo.CodeInvalidNumber)
 	return
 }
 
+var defaultLimit, maxLimit = 5, 50
+
+// SetPagination sets the limit of list requests without one and the largest
+// limit, bigger ones are cut to it.
+func SetPagination(default_limit, max_limit int) {
+	defaultLimit, maxLimit = default_limit, max_limit
+}
+
 func GetLimitOffsetFromRequest(r *http.Request) (limit int, offset int, err_info errinfo.ErrorInfo) {
 	s_limit := r.URL.Query().Get("limit")
 	s_offset := r.URL.Query().Get("offset")
@@ -31,16 +38,21 @@ func GetLimitOffsetFromRequest(r *http.Request) (limit int, offset int, err_info
 	//var limit, offset int
 
 	if s_limit == "" {
-		s_limit = "5"
+		s_limit = strconv.Itoa(defaultLimit)
 	}
 
 	if s_offset == "" {
 		s_offset = "0"
 	}
-	err_info.Status = 200
 	limit, err_info = Atoi(s_limit)
-	if err_info.Status == 200 {
-		offset, err_info = Atoi(s_offset)
+	if err_info.Status != 200 {
+		err_info = err_info.WithField("limit", err_info.Reason)
+		return
+	}
+	limit = min(limit, maxLimit)
+	offset, err_info = Atoi(s_offset)
+	if err_info.Status != 200 {
+		err_info = err_info.WithField("offset", err_info.Reason)
 	}
 	return
 
@@ -52,10 +64,9 @@ func IsOkServiceType(service_type string) bool {
 
 func ParseUUID(s_id string) (uuid.UUID, errinfo.ErrorInfo) {
 	id, err := uuid.Parse(s_id)
-	var err_info errinfo.ErrorInfo
-	err_info.Init(200, "Ok")
+	err_info := errinfo.Ok()
 	if err != nil {
-		err_info.Init(400, errinfo.ErrMessageWrongRequest)
+		err_info = errinfo.New(errinfo.CodeWrongRequest)
 	}
 
 	return id, err_info
@@ -0,0 +1,39 @@
+// Package httprec buffers a response, so that a middleware can look at it
+// before it is sent.
+package httprec
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Recorder is an http.ResponseWriter keeping the body in the embedded
+// buffer until Send.
+type Recorder struct {
+	bytes.Buffer
+	header http.Header
+	Status int
+}
+
+// New starts with a copy of header, i.e. the headers set by the middlewares
+// before the handler.
+func New(header http.Header) *Recorder {
+	return &Recorder{header: header.Clone(), Status: http.StatusOK}
+}
+
+func (rec *Recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *Recorder) WriteHeader(status int) {
+	rec.Status = status
+}
+
+// Send writes the recorded response to w.
+func (rec *Recorder) Send(w http.ResponseWriter) {
+	for key, values := range rec.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Bytes())
+}
@@ -0,0 +1,36 @@
+package httprec
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "req")
+	rec := New(w.Header())
+	rec.Header().Set("Content-Type", "application/json")
+	rec.WriteHeader(http.StatusCreated)
+	fmt.Fprint(rec, `{"id":1}`)
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Fatal("response sent before Send")
+	}
+
+	rec.Send(w)
+	if w.Code != http.StatusCreated || w.Body.String() != `{"id":1}` {
+		t.Errorf("sent %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "application/json" || w.Header().Get("X-Request-ID") != "req" {
+		t.Errorf("sent headers %v", w.Header())
+	}
+}
+
+func TestRecorderDefaultStatus(t *testing.T) {
+	rec := New(http.Header{})
+	fmt.Fprint(rec, "ok")
+	if rec.Status != http.StatusOK {
+		t.Errorf("status = %d", rec.Status)
+	}
+}
@@ -0,0 +1,38 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// Middleware takes the request ID sent by the client or generates a new one,
+// stores it in the request context and echoes it in the response headers.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request_id := r.Header.Get(Header)
+		if request_id == "" || len(request_id) > 100 {
+			request_id = uuid.NewString()
+		}
+		w.Header().Set(Header, request_id)
+		ctx := context.WithValue(r.Context(), contextKey{}, request_id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func FromContext(ctx context.Context) string {
+	request_id, _ := ctx.Value(contextKey{}).(string)
+	return request_id
+}
+
+func FromRequest(r *http.Request) string {
+	if request_id := FromContext(r.Context()); request_id != "" {
+		return request_id
+	}
+	return r.Header.Get(Header)
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings, see Load for where they come from.
+type Config struct {
+	Server         ServerConfig         `yaml:"server" toml:"server"`
+	Database       DatabaseConfig       `yaml:"database" toml:"database"`
+	Pagination     PaginationConfig     `yaml:"pagination" toml:"pagination"`
+	Bids           BidsConfig           `yaml:"bids" toml:"bids"`
+	Qualifications QualificationsConfig `yaml:"qualifications" toml:"qualifications"`
+	Auth           AuthConfig           `yaml:"auth" toml:"auth"`
+	Features       FeaturesConfig       `yaml:"features" toml:"features"`
+	RateLimit      RateLimitConfig      `yaml:"rate_limit" toml:"rate_limit"`
+	Attachments    AttachmentsConfig    `yaml:"attachments" toml:"attachments"`
+	Idempotency    IdempotencyConfig    `yaml:"idempotency" toml:"idempotency"`
+	Cache          CacheConfig          `yaml:"cache" toml:"cache"`
+	Log            LogConfig            `yaml:"log" toml:"log"`
+	Tracing        TracingConfig        `yaml:"tracing" toml:"tracing"`
+}
+
+type ServerConfig struct {
+	Address           string        `yaml:"address" toml:"address"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// ShutdownDelay is how long the server keeps serving after SIGTERM while
+	// reporting not ready, so load balancers stop sending new traffic.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay"`
+	// ShutdownTimeout bounds the drain of in-flight requests.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// RequestTimeout cancels the queries of a request that runs longer; the
+	// client gets a 504. 0 turns it off.
+	RequestTimeout time.Duration `yaml:"request_timeout" toml:"request_timeout"`
+	// RouteTimeouts overrides deadline.DefaultRoutes, see deadline.ParseRoutes.
+	RouteTimeouts string `yaml:"route_timeouts" toml:"route_timeouts"`
+}
+
+type DatabaseConfig struct {
+	Conn string `yaml:"conn" toml:"conn"`
+	// MaxOpenConns of 0 means unlimited, as in database/sql.
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	// StartupTimeout is how long commands wait for the database to answer.
+	StartupTimeout time.Duration `yaml:"startup_timeout" toml:"startup_timeout"`
+	// RetryAttempts and RetryBackoff bound the retries of transient errors,
+	// see dbhelp.RetryPolicy.
+	RetryAttempts int           `yaml:"retry_attempts" toml:"retry_attempts"`
+	RetryBackoff  time.Duration `yaml:"retry_backoff" toml:"retry_backoff"`
+}
+
+// PaginationConfig applies to the list endpoints; larger limits are cut to
+// MaxLimit. The API contract allows at most 50.
+type PaginationConfig struct {
+	DefaultLimit int `yaml:"default_limit" toml:"default_limit"`
+	MaxLimit     int `yaml:"max_limit" toml:"max_limit"`
+}
+
+type BidsConfig struct {
+	// DecisionQuorum is how many approvals accept a bid, or all responsible
+	// employees of the tender organization if there are fewer of them.
+	DecisionQuorum int `yaml:"decision_quorum" toml:"decision_quorum"`
+}
+
+type QualificationsConfig struct {
+	// Reviewers are the usernames allowed to approve or reject supplier
+	// qualifications, see package qualifications.
+	Reviewers []string `yaml:"reviewers" toml:"reviewers"`
+}
+
+type AuthConfig struct {
+	// APIKeys, if any, are required from callers of /api/, see auth.Middleware.
+	APIKeys []string `yaml:"api_keys" toml:"api_keys"`
+}
+
+type FeaturesConfig struct {
+	ValidateResponses bool `yaml:"validate_responses" toml:"validate_responses"`
+	RateLimit         bool `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+type RateLimitConfig struct {
+	// Routes overrides ratelimit.DefaultRoutes, see ratelimit.ParseRoutes.
+	Routes string `yaml:"routes" toml:"routes"`
+	// Default is the policy of all other routes, none if empty.
+	Default string `yaml:"default" toml:"default"`
+	// RedisURL shares limits between replicas; in-process if empty.
+	RedisURL string `yaml:"redis_url" toml:"redis_url"`
+	// Client limits each client IP before its user is looked up, "off" for
+	// none. It is looser than the user policies, as many users may share a
+	// proxy.
+	Client string `yaml:"client" toml:"client"`
+	// TrustedProxies are the addresses and CIDR ranges whose X-Forwarded-For
+	// gives the client IP.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+type AttachmentsConfig struct {
+	// BlobStoreURL is where attachment contents are kept, see
+	// attachments.NewBlobStore.
+	BlobStoreURL string `yaml:"blob_store_url" toml:"blob_store_url"`
+	// MaxSize is the largest accepted attachment in bytes.
+	MaxSize int64 `yaml:"max_size" toml:"max_size"`
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long responses to Idempotency-Key requests are kept.
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// CacheConfig is the read cache of tenders, users and their organizations,
+// see package cache.
+type CacheConfig struct {
+	// Size is how many values each process keeps, 0 turns the cache off.
+	Size int `yaml:"size" toml:"size"`
+	// TTL bounds how long a value is kept.
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+	// RedisURL shares the cache between replicas instead.
+	RedisURL string `yaml:"redis_url" toml:"redis_url"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" toml:"level"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, otlp or stdout.
+	Exporter string `yaml:"exporter" toml:"exporter"`
+}
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Address:           ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			RequestTimeout:    10 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			StartupTimeout:  60 * time.Second,
+			RetryAttempts:   3,
+			RetryBackoff:    50 * time.Millisecond,
+		},
+		Pagination:  PaginationConfig{DefaultLimit: 5, MaxLimit: 50},
+		Bids:        BidsConfig{DecisionQuorum: 3},
+		Features:    FeaturesConfig{RateLimit: true},
+		RateLimit:   RateLimitConfig{Client: "ip:600/1m:100"},
+		Attachments: AttachmentsConfig{BlobStoreURL: "file:data/attachments", MaxSize: 20 << 20},
+		Idempotency: IdempotencyConfig{TTL: 24 * time.Hour},
+		Cache:       CacheConfig{Size: 10000, TTL: 5 * time.Minute},
+		Log:         LogConfig{Level: "info"},
+		Tracing:     TracingConfig{Exporter: "none"},
+	}
+}
+
+// Validate reports every invalid setting at once, by its key.
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, message string) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, message))
+		}
+	}
+	check(cfg.Server.Address != "", "server.address", "must not be empty")
+	for _, s := range cfg.settings() {
+		if d, ok := s.value.(*time.Duration); ok {
+			check(*d >= 0, s.key, "must not be negative")
+		}
+	}
+	check(cfg.Database.MaxOpenConns >= 0, "database.max_open_conns", "must not be negative")
+	check(cfg.Database.MaxIdleConns >= 0, "database.max_idle_conns", "must not be negative")
+	check(cfg.Database.RetryAttempts >= 1, "database.retry_attempts", "must be at least 1")
+	check(cfg.Pagination.MaxLimit >= 1 && cfg.Pagination.MaxLimit <= 50, "pagination.max_limit", "must be between 1 and 50")
+	check(cfg.Pagination.DefaultLimit >= 1 && cfg.Pagination.DefaultLimit <= cfg.Pagination.MaxLimit,
+		"pagination.default_limit", "must be between 1 and pagination.max_limit")
+	check(cfg.Bids.DecisionQuorum >= 1, "bids.decision_quorum", "must be at least 1")
+	for _, key := range cfg.Auth.APIKeys {
+		check(len(key) >= 16, "auth.api_keys", "every key must be at least 16 characters long")
+	}
+	check(cfg.Cache.Size >= 0, "cache.size", "must not be negative")
+	check(cfg.Attachments.MaxSize > 0, "attachments.max_size", "must be a positive number of bytes")
+	switch strings.ToLower(cfg.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level", fmt.Sprintf("%q is not one of debug, info, warn, error", cfg.Log.Level))
+	}
+	switch cfg.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	default:
+		check(false, "tracing.exporter", fmt.Sprintf("%q is not one of none, otlp, stdout", cfg.Tracing.Exporter))
+	}
+	return errors.Join(errs...)
+}
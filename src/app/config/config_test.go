@@ -0,0 +1,124 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, "app.yaml", `
+server:
+  address: ":9000"
+  read_timeout: 20s
+pagination:
+  default_limit: 10
+log:
+  level: debug
+`)
+	t.Setenv("HTTP_READ_TIMEOUT", "25s")
+	t.Setenv("LOG_LEVEL", "warn")
+	cfg, args, err := Load([]string{"-config", path, "-log.level", "error", "migrate", "-status"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Address != ":9000" || cfg.Pagination.DefaultLimit != 10 {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.Server.ReadTimeout != 25*time.Second {
+		t.Errorf("env does not override file: %v", cfg.Server.ReadTimeout)
+	}
+	if cfg.Log.Level != "error" {
+		t.Errorf("flag does not override env: %v", cfg.Log.Level)
+	}
+	if cfg.Server.WriteTimeout != 30*time.Second {
+		t.Errorf("default lost: %v", cfg.Server.WriteTimeout)
+	}
+	if strings.Join(args, " ") != "migrate -status" {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestTOML(t *testing.T) {
+	path := writeFile(t, "app.toml", `
+[database]
+max_open_conns = 7
+conn_max_lifetime = "5m"
+
+[auth]
+api_keys = ["0123456789abcdef"]
+`)
+	cfg, _, err := Load([]string{"-config", path}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.MaxOpenConns != 7 || cfg.Database.ConnMaxLifetime != 5*time.Minute || len(cfg.Auth.APIKeys) != 1 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{name: "unknown key", file: "server:\n  adress: x\n", want: []string{"adress"}},
+		{name: "bad env", env: map[string]string{"DB_MAX_OPEN_CONNS": "many"}, want: []string{`DB_MAX_OPEN_CONNS: "many" is not an integer`}},
+		{name: "bad flag", args: []string{"-server.idle_timeout", "soon"}, want: []string{"-server.idle_timeout"}},
+		{
+			name: "every invalid setting",
+			args: []string{"-pagination.default_limit", "80", "-bids.decision_quorum", "0", "-auth.api_keys", "short"},
+			want: []string{"pagination.default_limit", "bids.decision_quorum", "auth.api_keys"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			args := c.args
+			if c.file != "" {
+				args = append([]string{"-config", writeFile(t, "app.yml", c.file)}, args...)
+			}
+			for name, value := range c.env {
+				t.Setenv(name, value)
+			}
+			_, _, err := Load(args, io.Discard)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			for _, want := range c.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("%q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+// The example file documents the defaults, so it must load to them.
+func TestExampleFile(t *testing.T) {
+	cfg, _, err := Load([]string{"-config", "../config.example.yaml"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Default()
+	want.Auth.APIKeys = []string{}
+	want.Qualifications.Reviewers = []string{}
+	want.RateLimit.TrustedProxies = []string{}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("example = %+v\ndefault = %+v", cfg, want)
+	}
+}
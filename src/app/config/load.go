@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// setting binds a Config field to its file key, which is also the flag
+// name, and to its environment variable.
+type setting struct {
+	key   string
+	env   string
+	value interface{}
+}
+
+func (cfg *Config) settings() []setting {
+	return []setting{
+		{"server.address", "SERVER_ADDRESS", &cfg.Server.Address},
+		{"server.read_timeout", "HTTP_READ_TIMEOUT", &cfg.Server.ReadTimeout},
+		{"server.read_header_timeout", "HTTP_READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout},
+		{"server.write_timeout", "HTTP_WRITE_TIMEOUT", &cfg.Server.WriteTimeout},
+		{"server.idle_timeout", "HTTP_IDLE_TIMEOUT", &cfg.Server.IdleTimeout},
+		{"server.shutdown_delay", "SHUTDOWN_DELAY", &cfg.Server.ShutdownDelay},
+		{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout},
+		{"server.request_timeout", "HTTP_REQUEST_TIMEOUT", &cfg.Server.RequestTimeout},
+		{"server.route_timeouts", "HTTP_ROUTE_TIMEOUTS", &cfg.Server.RouteTimeouts},
+		{"database.conn", "POSTGRES_CONN", &cfg.Database.Conn},
+		{"database.max_open_conns", "DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns},
+		{"database.max_idle_conns", "DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns},
+		{"database.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime},
+		{"database.startup_timeout", "DB_STARTUP_TIMEOUT", &cfg.Database.StartupTimeout},
+		{"database.retry_attempts", "DB_RETRY_ATTEMPTS", &cfg.Database.RetryAttempts},
+		{"database.retry_backoff", "DB_RETRY_BACKOFF", &cfg.Database.RetryBackoff},
+		{"pagination.default_limit", "PAGINATION_DEFAULT_LIMIT", &cfg.Pagination.DefaultLimit},
+		{"pagination.max_limit", "PAGINATION_MAX_LIMIT", &cfg.Pagination.MaxLimit},
+		{"bids.decision_quorum", "BID_DECISION_QUORUM", &cfg.Bids.DecisionQuorum},
+		{"qualifications.reviewers", "QUALIFICATION_REVIEWERS", &cfg.Qualifications.Reviewers},
+		{"auth.api_keys", "API_KEYS", &cfg.Auth.APIKeys},
+		{"features.validate_responses", "OPENAPI_VALIDATE_RESPONSES", &cfg.Features.ValidateResponses},
+		{"features.rate_limit", "RATE_LIMIT_ENABLED", &cfg.Features.RateLimit},
+		{"rate_limit.routes", "RATE_LIMIT_ROUTES", &cfg.RateLimit.Routes},
+		{"rate_limit.default", "RATE_LIMIT_DEFAULT", &cfg.RateLimit.Default},
+		{"rate_limit.redis_url", "RATE_LIMIT_REDIS_URL", &cfg.RateLimit.RedisURL},
+		{"rate_limit.client", "RATE_LIMIT_CLIENT", &cfg.RateLimit.Client},
+		{"rate_limit.trusted_proxies", "RATE_LIMIT_TRUSTED_PROXIES", &cfg.RateLimit.TrustedProxies},
+		{"attachments.blob_store_url", "BLOB_STORE_URL", &cfg.Attachments.BlobStoreURL},
+		{"attachments.max_size", "ATTACHMENT_MAX_SIZE", &cfg.Attachments.MaxSize},
+		{"idempotency.ttl", "IDEMPOTENCY_TTL", &cfg.Idempotency.TTL},
+		{"cache.size", "CACHE_SIZE", &cfg.Cache.Size},
+		{"cache.ttl", "CACHE_TTL", &cfg.Cache.TTL},
+		{"cache.redis_url", "CACHE_REDIS_URL", &cfg.Cache.RedisURL},
+		{"log.level", "LOG_LEVEL", &cfg.Log.Level},
+		{"tracing.exporter", "OTEL_TRACES_EXPORTER", &cfg.Tracing.Exporter},
+	}
+}
+
+// set parses value into the field; lists are comma separated.
+func (s setting) set(value string) error {
+	var err error
+	kind := ""
+	switch v := s.value.(type) {
+	case *string:
+		*v = value
+	case *bool:
+		*v, err = strconv.ParseBool(value)
+		kind = "a boolean"
+	case *int:
+		*v, err = strconv.Atoi(value)
+		kind = "an integer"
+	case *int64:
+		*v, err = strconv.ParseInt(value, 10, 64)
+		kind = "an integer"
+	case *time.Duration:
+		*v, err = time.ParseDuration(value)
+		kind = "a duration such as 30s"
+	case *[]string:
+		*v = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*v = append(*v, item)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not %s", value, kind)
+	}
+	return nil
+}
+
+// Load starts from Default and applies, each overriding the previous one:
+// the YAML or TOML file given by -config or CONFIG_FILE, the environment,
+// and the flags before the subcommand. It returns the arguments after the
+// flags and fails with every invalid setting listed.
+func Load(args []string, stderr io.Writer) (Config, []string, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	flags := flag.NewFlagSet("global", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	config_file := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML (.yaml, .yml) or TOML (.toml) config file, env CONFIG_FILE")
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+	var flag_values []flagValue
+	for _, s := range settings {
+		flags.Func(s.key, "env "+s.env, func(value string) error {
+			flag_values = append(flag_values, flagValue{s, value})
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if *config_file != "" {
+		if err := cfg.loadFile(*config_file); err != nil {
+			return cfg, nil, fmt.Errorf("config file %s: %w", *config_file, err)
+		}
+	}
+	var errs []error
+	for _, s := range settings {
+		if value := os.Getenv(s.env); value != "" {
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	for _, f := range flag_values {
+		if err := f.setting.set(f.value); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", f.setting.key, err))
+		}
+	}
+	if len(errs) == 0 {
+		errs = append(errs, cfg.Validate())
+	}
+	return cfg, flags.Args(), errors.Join(errs...)
+}
+
+// loadFile decodes the file over cfg, keys missing from the file keep their
+// values and unknown keys are errors.
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(cfg); err == io.EOF {
+			err = nil
+		}
+		return err
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) != 0 {
+			return fmt.Errorf("unknown key %s", undecoded[0])
+		}
+		return nil
+	}
+	return errors.New("must be .yaml, .yml or .toml")
+}
@@ -0,0 +1,84 @@
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Off leaves a route without a deadline of its own; it is then bounded only
+// by the write timeout of the server.
+const Off time.Duration = 0
+
+// DefaultRoutes exempt the routes that stream files or take a batch of rows,
+// so they are not cut by the deadline meant for single queries.
+var DefaultRoutes = map[string]time.Duration{
+	"POST /api/tenders/import":                               Off,
+	"GET /api/tenders/my/export":                             Off,
+	"GET /api/bids/{tenderId}/list/export":                   Off,
+	"GET /api/bids/{tenderId}/reviews/export":                Off,
+	"GET /api/bids/{tenderId}/decisions/export":              Off,
+	"POST /api/tenders/{tenderId}/attachments":               Off,
+	"GET /api/tenders/{tenderId}/attachments/{attachmentId}": Off,
+	"POST /api/bids/{bidId}/attachments":                     Off,
+	"GET /api/bids/{bidId}/attachments/{attachmentId}":       Off,
+}
+
+// ParseRoutes applies "<METHOD> <route template>=<duration>;..." on top of
+// DefaultRoutes. The duration "off" removes the deadline from a route.
+func ParseRoutes(s string) (map[string]time.Duration, error) {
+	routes := map[string]time.Duration{}
+	for route, timeout := range DefaultRoutes {
+		routes[route] = timeout
+	}
+	for _, item := range strings.Split(s, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		route, s_timeout, ok := strings.Cut(item, "=")
+		route = strings.Join(strings.Fields(route), " ")
+		if !ok || len(strings.Fields(route)) != 2 {
+			return nil, fmt.Errorf("route timeout %q: want <METHOD> <route>=<duration>", item)
+		}
+		s_timeout = strings.TrimSpace(s_timeout)
+		if s_timeout == "off" {
+			routes[route] = Off
+			continue
+		}
+		timeout, err := time.ParseDuration(s_timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("route timeout %q: bad duration %q", item, s_timeout)
+		}
+		routes[route] = timeout
+	}
+	return routes, nil
+}
+
+// Middleware cancels the request context after the timeout of its route
+// template, or after fallback for the routes not listed. Queries still
+// running then fail and the handlers answer 504, see dbhelp.SqlErrToErrInfo.
+func Middleware(fallback time.Duration, routes map[string]time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := fallback
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					if route_timeout, ok := routes[r.Method+" "+template]; ok {
+						timeout = route_timeout
+					}
+				}
+			}
+			if timeout == Off {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package deadline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("GET  /api/audit=30s; POST /api/tenders/import=1m;GET /api/bids/my=off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routes["GET /api/audit"] != 30*time.Second || routes["POST /api/tenders/import"] != time.Minute {
+		t.Errorf("routes = %v", routes)
+	}
+	if timeout, ok := routes["GET /api/bids/my"]; !ok || timeout != Off {
+		t.Errorf("bids/my deadline not removed: %v", routes)
+	}
+	if timeout, ok := routes["GET /api/tenders/my/export"]; !ok || timeout != Off {
+		t.Error("default routes lost")
+	}
+	for _, s := range []string{"/api/audit=1s", "GET /api/audit", "GET /api/audit=soon", "GET /api/audit=-1s"} {
+		if _, err := ParseRoutes(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	routes := map[string]time.Duration{"GET /slow/{id}": time.Minute, "GET /stream": Off}
+	r := mux.NewRouter()
+	r.Use(Middleware(time.Second, routes))
+	var remaining time.Duration
+	var has_deadline bool
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var deadline time.Time
+		deadline, has_deadline = r.Context().Deadline()
+		remaining = time.Until(deadline)
+	}
+	r.HandleFunc("/fast", handler)
+	r.HandleFunc("/slow/{id}", handler)
+	r.HandleFunc("/stream", handler)
+
+	cases := []struct {
+		path string
+		min  time.Duration
+		max  time.Duration
+	}{
+		{"/fast", 0, time.Second},
+		{"/slow/1", time.Second, time.Minute},
+	}
+	for _, c := range cases {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", c.path, nil))
+		if !has_deadline || remaining <= c.min || remaining > c.max {
+			t.Errorf("%s: deadline in %v", c.path, remaining)
+		}
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stream", nil))
+	if has_deadline {
+		t.Error("/stream has a deadline")
+	}
+}
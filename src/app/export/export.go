@@ -0,0 +1,200 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/logging"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Writer streams table rows in one of the formats.
+type Writer interface {
+	WriteRow(values ...interface{}) error
+	Close() error
+}
+
+// ParseFormat reads the format parameter, csv by default.
+func ParseFormat(r *http.Request) (string, errinfo.ErrorInfo) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return FormatCSV, errinfo.Ok()
+	}
+	if _, ok := contentTypes[format]; !ok {
+		return "", errinfo.New(errinfo.CodeValidationFailed).WithField("format", "Must be csv or xlsx.")
+	}
+	return format, errinfo.Ok()
+}
+
+// LimitOffset reads the pagination parameters of the list endpoints, but
+// without limit everything is exported: a NULL limit means no limit.
+func LimitOffset(r *http.Request) (limit sql.NullInt64, offset int, err_info errinfo.ErrorInfo) {
+	err_info = errinfo.Ok()
+	if s_limit := r.URL.Query().Get("limit"); s_limit != "" {
+		value, err_info := helpers.Atoi(s_limit)
+		if err_info.Status != 200 {
+			return limit, 0, err_info.WithField("limit", err_info.Reason)
+		}
+		limit = sql.NullInt64{Int64: int64(value), Valid: true}
+	}
+	if s_offset := r.URL.Query().Get("offset"); s_offset != "" {
+		if offset, err_info = helpers.Atoi(s_offset); err_info.Status != 200 {
+			err_info = err_info.WithField("offset", err_info.Reason)
+		}
+	}
+	return
+}
+
+// NewWriter writes the header row.
+func NewWriter(w io.Writer, format string, header ...string) (Writer, error) {
+	var writer Writer
+	if format == FormatXLSX {
+		xlsx, err := newXLSXWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		writer = xlsx
+	} else {
+		writer = &csvWriter{csv: csv.NewWriter(w)}
+	}
+	values := make([]interface{}, len(header))
+	for i, title := range header {
+		values[i] = title
+	}
+	return writer, writer.WriteRow(values...)
+}
+
+type csvWriter struct {
+	csv *csv.Writer
+}
+
+// csvValue formats the value and, since the files are opened in
+// spreadsheets, keeps text starting like a formula from being evaluated.
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case string:
+		if v != "" && (v[0] == '=' || v[0] == '+' || v[0] == '-' || v[0] == '@') {
+			return "'" + v
+		}
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+func (c *csvWriter) WriteRow(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = csvValue(value)
+	}
+	return c.csv.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+// xlsxWriter keeps rows in the excelize stream writer, which spills them to
+// a temporary file, and writes the workbook on Close.
+type xlsxWriter struct {
+	w          io.Writer
+	file       *excelize.File
+	stream     *excelize.StreamWriter
+	date_style int
+	row        int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	date_style, err := file.NewStyle(&excelize.Style{NumFmt: 22})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &xlsxWriter{w: w, file: file, stream: stream, date_style: date_style}, nil
+}
+
+func (x *xlsxWriter) WriteRow(values ...interface{}) error {
+	x.row++
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			cells[i] = excelize.Cell{StyleID: x.date_style, Value: t.UTC()}
+		} else {
+			cells[i] = value
+		}
+	}
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.stream.SetRow(cell, cells)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.w)
+}
+
+// Table is a query result to export, Scan reads the current row of Rows.
+type Table struct {
+	Name   string
+	Header []string
+	Rows   *sql.Rows
+	Scan   func() ([]interface{}, error)
+}
+
+// Write streams the rows to w and closes them.
+func (t *Table) Write(w io.Writer, format string) error {
+	defer t.Rows.Close()
+	out, err := NewWriter(w, format, t.Header...)
+	if err != nil {
+		return err
+	}
+	for err == nil && t.Rows.Next() {
+		var values []interface{}
+		if values, err = t.Scan(); err == nil {
+			err = out.WriteRow(values...)
+		}
+	}
+	return errors.Join(err, t.Rows.Err(), out.Close())
+}
+
+// Send streams the table as a download. The headers are already sent when
+// the rows are read, so failures can only be logged.
+func Send(w http.ResponseWriter, r *http.Request, format string, table *Table) {
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": table.Name + "." + format}))
+	if err := table.Write(w, format); err != nil {
+		logging.FromRequest(r).Error("export: interrupted", "name", table.Name, "err", err)
+	}
+}
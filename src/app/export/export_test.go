@@ -0,0 +1,55 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func writeRows(t *testing.T, format string) *bytes.Buffer {
+	var buf bytes.Buffer
+	out, err := NewWriter(&buf, format, "name", "count", "created_at")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created_at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"Roads", "=HYPERLINK(1)"} {
+		if err = out.WriteRow(name, 3, created_at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestCSV(t *testing.T) {
+	buf := writeRows(t, FormatCSV)
+	want := "name,count,created_at\nRoads,3,2024-05-01T12:00:00Z\n'=HYPERLINK(1),3,2024-05-01T12:00:00Z\n"
+	if buf.String() != want {
+		t.Errorf("body = %q", buf.String())
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	buf := writeRows(t, FormatXLSX)
+	file, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := file.GetRows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][0] != "Roads" || rows[2][0] != "=HYPERLINK(1)" || rows[1][1] != "3" {
+		t.Errorf("rows = %v", rows)
+	}
+	formula, _ := file.GetCellFormula("Sheet1", "A3")
+	if formula != "" {
+		t.Errorf("text became formula %q", formula)
+	}
+}
@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go_server/m/migrations"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Checker serves the liveness and readiness probes. Liveness only says the
+// process is up; readiness also needs the database and its migrations.
+type Checker struct {
+	db       *sql.DB
+	draining atomic.Bool
+}
+
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func NewChecker(db *sql.DB) *Checker {
+	return &Checker{db: db}
+}
+
+// SetDraining makes readiness fail from now on, while the server still
+// finishes the requests it has.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+func sendStatus(w http.ResponseWriter, status_code int, status Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status_code)
+	json.NewEncoder(w).Encode(status)
+}
+
+func (c *Checker) LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendStatus(w, http.StatusOK, Status{Status: "ok"})
+	}
+}
+
+func (c *Checker) checkMigrations(ctx context.Context) error {
+	pending, err := migrations.Pending(ctx, c.db)
+	if err != nil {
+		return err
+	}
+	if len(pending) != 0 {
+		return fmt.Errorf("pending migrations %v", pending)
+	}
+	return nil
+}
+
+func (c *Checker) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		status := Status{Status: "ready", Checks: map[string]string{}}
+		status_code := http.StatusOK
+		fail := func(check string, err error) {
+			status.Status = "not ready"
+			status.Checks[check] = err.Error()
+			status_code = http.StatusServiceUnavailable
+		}
+
+		if c.draining.Load() {
+			fail("server", fmt.Errorf("shutting down"))
+		}
+		if err := c.db.PingContext(ctx); err != nil {
+			fail("database", err)
+		} else {
+			status.Checks["database"] = "ok"
+			if err := c.checkMigrations(ctx); err != nil {
+				fail("migrations", err)
+			} else {
+				status.Checks["migrations"] = "ok"
+			}
+		}
+		sendStatus(w, status_code, status)
+	}
+}
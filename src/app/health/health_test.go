@@ -0,0 +1,42 @@
+package health
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+func TestLiveness(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewChecker(nil).LivenessHandler()(rec, httptest.NewRequest("GET", "/health/live", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+}
+
+func TestReadinessWithoutDatabase(t *testing.T) {
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checker := NewChecker(db)
+	checker.SetDraining()
+
+	rec := httptest.NewRecorder()
+	checker.ReadinessHandler()(rec, httptest.NewRequest("GET", "/health/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", rec.Code)
+	}
+	var status Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Checks["database"] == "" || status.Checks["server"] == "" {
+		t.Errorf("checks = %v", status.Checks)
+	}
+}
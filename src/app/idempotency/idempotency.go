@@ -0,0 +1,200 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/httprec"
+	"go_server/m/logging"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// Keys remembers the first response to a POST sent with an Idempotency-Key,
+// per key and organization, for ttl.
+type Keys struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+func NewKeys(db *sql.DB, ttl time.Duration) *Keys {
+	return &Keys{db: db, ttl: ttl}
+}
+
+type storedResponse struct {
+	requestHash string
+	status      sql.NullInt64
+	contentType sql.NullString
+	body        []byte
+}
+
+// scopeFromBody finds the organization of the tender being created, the
+// organization authoring the bid, or that of the employee authoring it. The
+// bids of an employee without organization are scoped to the employee.
+func scopeFromBody(ctx context.Context, db *sql.DB, data []byte) (string, bool) {
+	var body struct {
+		OrganizationId int    `json:"organizationId"`
+		AuthorType     string `json:"authorType"`
+		AuthorId       int    `json:"authorId"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		return "", false
+	}
+	if body.OrganizationId != 0 {
+		return "organization:" + strconv.Itoa(body.OrganizationId), true
+	}
+	if body.AuthorId == 0 {
+		return "", false
+	}
+	if body.AuthorType == "Organization" {
+		return "organization:" + strconv.Itoa(body.AuthorId), true
+	}
+	user_name, err_info := dbhelp.GetUserName(ctx, db, body.AuthorId)
+	if err_info.Status != 200 {
+		return "", false
+	}
+	organization_id, err_info := dbhelp.GetUserOrganizationId(ctx, db, user_name)
+	if err_info.Code == errinfo.CodeNoPermission {
+		// An individual supplier, responsible for no organization.
+		return "user:" + strconv.Itoa(body.AuthorId), true
+	}
+	if err_info.Status != 200 {
+		return "", false
+	}
+	return "organization:" + strconv.Itoa(organization_id), true
+}
+
+// requestHash ignores insignificant whitespace of JSON bodies.
+func requestHash(r *http.Request, data []byte) string {
+	var compact bytes.Buffer
+	if json.Compact(&compact, data) == nil {
+		data = compact.Bytes()
+	}
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// reserve inserts the key as in progress. When the key exists it returns the
+// stored row instead, after dropping it if it has expired.
+func (k *Keys) reserve(ctx context.Context, scope, key, request_hash string) (reserved bool, stored storedResponse, err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result, err := k.db.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (scope, key, request_hash, expires_at)
+			VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+			ON CONFLICT (scope, key) DO NOTHING`,
+			scope, key, request_hash, k.ttl.Milliseconds())
+		if err != nil {
+			return false, stored, err
+		}
+		if count, _ := result.RowsAffected(); count == 1 {
+			return true, stored, nil
+		}
+
+		var expired bool
+		err = k.db.QueryRowContext(ctx, `
+			SELECT request_hash, status, content_type, response, expires_at <= now()
+			FROM idempotency_keys
+			WHERE scope = $1 AND key = $2`, scope, key).
+			Scan(&stored.requestHash, &stored.status, &stored.contentType, &stored.body, &expired)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return false, stored, err
+		}
+		if !expired {
+			return false, stored, nil
+		}
+		_, err = k.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND expires_at <= now()`,
+			scope, key)
+		if err != nil {
+			return false, stored, err
+		}
+	}
+	return false, stored, sql.ErrNoRows
+}
+
+func (k *Keys) complete(ctx context.Context, scope, key string, rec *httprec.Recorder) error {
+	if rec.Status >= http.StatusInternalServerError {
+		// Let the client retry a failure with the same key.
+		_, err := k.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2`, scope, key)
+		return err
+	}
+	_, err := k.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status = $3, content_type = $4, response = $5
+		WHERE scope = $1 AND key = $2`,
+		scope, key, rec.Status, rec.Header().Get("Content-Type"), rec.Bytes())
+	return err
+}
+
+// Wrap makes next idempotent for requests carrying the Idempotency-Key
+// header. Requests without it, or whose organization is unknown and will be
+// rejected by next anyway, are passed through.
+func (k *Keys) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		scope, ok := scopeFromBody(r.Context(), k.db, data)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		request_hash := requestHash(r, data)
+		reserved, stored, err := k.reserve(r.Context(), scope, key, request_hash)
+		if err != nil {
+			errinfo.SendHttpErr(w, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer))
+			return
+		}
+		if !reserved {
+			switch {
+			case stored.requestHash != request_hash:
+				errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeIdempotencyKeyReused))
+			case !stored.status.Valid:
+				errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeIdempotencyInProgress))
+			default:
+				logging.FromRequest(r).Debug("replaying idempotent response", "key", key, "scope", scope)
+				if stored.contentType.String != "" {
+					w.Header().Set("Content-Type", stored.contentType.String)
+				}
+				w.Header().Set(ReplayedHeader, "true")
+				w.WriteHeader(int(stored.status.Int64))
+				w.Write(stored.body)
+			}
+			return
+		}
+
+		rec := httprec.New(w.Header())
+		next(rec, r)
+		// The response is stored even if the request timed out meanwhile.
+		if err := k.complete(context.WithoutCancel(r.Context()), scope, key, rec); err != nil {
+			logging.FromRequest(r).Error("can't store idempotent response", "key", key, "err", err)
+		}
+		rec.Send(w)
+	}
+}
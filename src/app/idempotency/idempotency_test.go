@@ -0,0 +1,52 @@
+package idempotency
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestHash(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/tenders/new", nil)
+	hash := requestHash(r, []byte(`{"name":"Tender","organizationId":1}`))
+	spaced := requestHash(r, []byte("{\n  \"name\": \"Tender\",\n  \"organizationId\": 1\n}\n"))
+	if hash != spaced {
+		t.Error("whitespace changed the hash")
+	}
+	if hash == requestHash(r, []byte(`{"name":"Tender","organizationId":2}`)) {
+		t.Error("body change kept the hash")
+	}
+	if hash == requestHash(r, []byte(`{"name":"Tender ","organizationId":1}`)) {
+		t.Error("whitespace inside a string ignored")
+	}
+	other := httptest.NewRequest("POST", "/api/bids/new", nil)
+	if hash == requestHash(other, []byte(`{"name":"Tender","organizationId":1}`)) {
+		t.Error("path change kept the hash")
+	}
+	if requestHash(r, []byte("not json")) == requestHash(r, []byte("not  json")) {
+		t.Error("non JSON body compacted")
+	}
+}
+
+// Bids by an employee are resolved through the database, see
+// TestIdempotentBidByUser.
+func TestScopeFromBody(t *testing.T) {
+	for _, c := range []struct {
+		body  string
+		scope string
+		ok    bool
+	}{
+		{`{"name":"Tender","organizationId":3}`, "organization:3", true},
+		{`{"authorType":"Organization","authorId":2}`, "organization:2", true},
+		{`{"organizationId":3,"authorType":"User","authorId":7}`, "organization:3", true},
+		{`{"authorType":"User"}`, "", false},
+		{`{}`, "", false},
+		{`not json`, "", false},
+		{`{"organizationId":"3"}`, "", false},
+	} {
+		scope, ok := scopeFromBody(context.Background(), nil, []byte(c.body))
+		if scope != c.scope || ok != c.ok {
+			t.Errorf("%s: got %q, %v", c.body, scope, ok)
+		}
+	}
+}
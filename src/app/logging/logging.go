@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go_server/m/common/requestid"
+
+	"github.com/gorilla/mux"
+)
+
+// ParseLevel accepts debug, info, warn and error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// Setup makes a JSON handler writing to w the default for both slog and the
+// standard log package.
+func Setup(w io.Writer, level string) error {
+	parsed_level, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: parsed_level})))
+	return nil
+}
+
+func SetupStdout(level string) error {
+	return Setup(os.Stdout, level)
+}
+
+type contextKey struct{}
+
+// requestState is shared between the middleware and the handler, which may
+// learn the actor only after reading the body.
+type requestState struct {
+	logger *slog.Logger
+	actor  string
+}
+
+func (state *requestState) actorLogger() *slog.Logger {
+	if state.actor == "" {
+		return state.logger
+	}
+	return state.logger.With("actor", state.actor)
+}
+
+func stateFromContext(ctx context.Context) *requestState {
+	state, _ := ctx.Value(contextKey{}).(*requestState)
+	return state
+}
+
+// FromContext returns the request logger, or the default one outside requests.
+func FromContext(ctx context.Context) *slog.Logger {
+	if state := stateFromContext(ctx); state != nil {
+		return state.actorLogger()
+	}
+	return slog.Default()
+}
+
+func FromRequest(r *http.Request) *slog.Logger {
+	return FromContext(r.Context())
+}
+
+// SetActor names the user the request acts for in the access log.
+func SetActor(ctx context.Context, actor string) {
+	if state := stateFromContext(ctx); state != nil && actor != "" {
+		state.actor = actor
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(data []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(data)
+	rec.bytes += n
+	return n, err
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return ""
+}
+
+// Middleware must run after requestid.Middleware. It gives the handler a
+// logger tagged with the request ID and writes one access-log line per request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		state := &requestState{logger: slog.Default().With(
+			"request_id", requestid.FromRequest(r),
+			"method", r.Method,
+			"route", routeTemplate(r),
+		)}
+		ctx := context.WithValue(r.Context(), contextKey{}, state)
+		query := r.URL.Query()
+		SetActor(ctx, firstNonEmpty(query.Get("username"), query.Get("requesterUsername")))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		state.actorLogger().LogAttrs(r.Context(), level, "request",
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go_server/m/common/requestid"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	if err := Setup(&out, "info"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(requestid.Middleware)
+	r.Use(Middleware)
+	r.HandleFunc("/api/tenders/new", func(w http.ResponseWriter, r *http.Request) {
+		FromRequest(r).Debug("hidden at info level")
+		SetActor(r.Context(), "user1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	})
+	req := httptest.NewRequest("POST", "/api/tenders/new", nil)
+	req.Header.Set(requestid.Header, "req-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("%d log lines, want 1: %s", len(lines), out.String())
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"msg":        "request",
+		"request_id": "req-1",
+		"route":      "/api/tenders/new",
+		"actor":      "user1",
+		"status":     float64(201),
+		"bytes":      float64(2),
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %v", key, line[key], value)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("verbose accepted")
+	}
+	if level, err := ParseLevel("DEBUG"); err != nil || level.String() != "DEBUG" {
+		t.Errorf("DEBUG parsed as %v, %v", level, err)
+	}
+}
@@ -1,14 +1,41 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 
+	"go_server/m/api"
+	"go_server/m/attachments"
+	"go_server/m/audit"
+	"go_server/m/auth"
 	"go_server/m/bids"
-	_ "go_server/m/common/errinfo"
+	"go_server/m/cache"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/common/requestid"
+	"go_server/m/config"
+	"go_server/m/deadline"
+	"go_server/m/health"
+	"go_server/m/idempotency"
+	"go_server/m/logging"
+	"go_server/m/metrics"
+	"go_server/m/migrations"
+	"go_server/m/notifications"
+	"go_server/m/qualifications"
+	"go_server/m/questions"
+	"go_server/m/ratelimit"
 	"go_server/m/tenders"
+	"go_server/m/tracing"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -16,49 +43,225 @@ import (
 )
 
 func pingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
 }
 
-func httpSetHandlers(db *sql.DB) {
+func errorHandler(code errinfo.ErrorCode) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		errinfo.SendHttpErr(w, errinfo.New(code))
+	}
+}
+
+func newLimiter(db *sql.DB, cfg config.Config) *ratelimit.Limiter {
+	routes, err := ratelimit.ParseRoutes(cfg.RateLimit.Routes)
+	if err != nil {
+		log.Fatal("RATE_LIMIT_ROUTES: ", err)
+	}
+	var fallback *ratelimit.Policy
+	if cfg.RateLimit.Default != "" {
+		policy, err := ratelimit.ParsePolicy(cfg.RateLimit.Default)
+		if err != nil {
+			log.Fatal("RATE_LIMIT_DEFAULT: ", err)
+		}
+		fallback = &policy
+	}
+	var client *ratelimit.Policy
+	if cfg.RateLimit.Client != "off" {
+		policy, err := ratelimit.ParsePolicy(cfg.RateLimit.Client)
+		if err != nil || policy.Key != ratelimit.KeyIP {
+			log.Fatal("RATE_LIMIT_CLIENT: must be off or an ip policy such as ip:600/1m:100")
+		}
+		client = &policy
+	}
+	proxies, err := ratelimit.ParseTrustedProxies(cfg.RateLimit.TrustedProxies)
+	if err != nil {
+		log.Fatal("RATE_LIMIT_TRUSTED_PROXIES: ", err)
+	}
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.RedisURL != "" {
+		if store, err = ratelimit.NewRedisStoreFromURL(cfg.RateLimit.RedisURL); err != nil {
+			log.Fatal("RATE_LIMIT_REDIS_URL: ", err)
+		}
+	}
+	return ratelimit.NewLimiter(store, db, routes, fallback, client, proxies)
+}
+
+func httpSetHandlers(db *sql.DB, cfg config.Config, checker *health.Checker) http.Handler {
+	helpers.SetPagination(cfg.Pagination.DefaultLimit, cfg.Pagination.MaxLimit)
+	validator, err := api.NewValidator(cfg.Features.ValidateResponses)
+	if err != nil {
+		log.Fatal("can't load OpenAPI spec: ", err)
+	}
+
+	if err = metrics.RegisterDB(db); err != nil {
+		log.Fatal("can't register DB metrics: ", err)
+	}
+	route_timeouts, err := deadline.ParseRoutes(cfg.Server.RouteTimeouts)
+	if err != nil {
+		log.Fatal("HTTP_ROUTE_TIMEOUTS: ", err)
+	}
+
 	r := mux.NewRouter()
+	r.Use(tracing.Middleware())
+	r.Use(requestid.Middleware)
+	r.Use(logging.Middleware)
+	r.Use(metrics.Middleware)
+	r.Use(deadline.Middleware(cfg.Server.RequestTimeout, route_timeouts))
+	r.Use(dbhelp.CacheMiddleware)
+	r.Use(auth.Middleware(cfg.Auth.APIKeys))
+	if cfg.Features.RateLimit {
+		r.Use(newLimiter(db, cfg).Middleware)
+	}
+	r.Use(validator.Middleware)
+	r.NotFoundHandler = requestid.Middleware(errorHandler(errinfo.CodeNotFound))
+	r.MethodNotAllowedHandler = requestid.Middleware(errorHandler(errinfo.CodeMethodNotAllowed))
 
-	//r.HandleFunc("/api/tenders", tenders.TendersHandler(db)).Methods("GET")
 	//r.HandleFunc("/api/archived_tenders", tenders.TendersArchiveHandler(db)).Methods("GET")
 	//r.HandleFunc("/api/bids", bids.BidsHandler(db)).Methods("GET")
 	//For manual testing
 
 	r.HandleFunc("/api/ping", pingHandler).Methods("GET")
+	r.HandleFunc("/health/live", checker.LivenessHandler()).Methods("GET")
+	r.HandleFunc("/health/ready", checker.ReadinessHandler()).Methods("GET")
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	blob_store, err := attachments.NewBlobStore(context.Background(), cfg.Attachments.BlobStoreURL)
+	if err != nil {
+		log.Fatal("BLOB_STORE_URL: ", err)
+	}
+	files := attachments.NewAttachments(db, blob_store, cfg.Attachments.MaxSize)
 
-	r.HandleFunc("/api/tenders/new", tenders.NewTenderHandler(db)).Methods("POST")
+	idempotency_keys := idempotency.NewKeys(db, cfg.Idempotency.TTL)
+	r.HandleFunc("/api/tenders", tenders.TendersHandler(db)).Methods("GET")
+	r.HandleFunc("/api/tenders/new", idempotency_keys.Wrap(tenders.NewTenderHandler(db))).Methods("POST")
+	r.HandleFunc("/api/tenders/import", tenders.ImportTendersHandler(db)).Methods("POST")
 	r.HandleFunc("/api/tenders/my", tenders.MyTendersHandler(db)).Methods("GET")
+	r.HandleFunc("/api/tenders/my/export", tenders.ExportTendersHandler(db)).Methods("GET")
 
 	r.HandleFunc("/api/tenders/{tenderId}/status", tenders.StatusTendersHandler(db)).Methods("GET", "PUT")
 	r.HandleFunc("/api/tenders/{tenderId}/edit", tenders.EditTendersHandler(db)).Methods("PATCH")
 	r.HandleFunc("/api/tenders/{tenderId}/rollback/{version}", tenders.RollbackTendersHandler(db)).Methods("PUT")
+	r.HandleFunc("/api/tenders/{tenderId}/owners", tenders.OwnersHandler(db)).Methods("GET")
+	r.HandleFunc("/api/tenders/{tenderId}/owners/{organizationId}", tenders.SetOwnerHandler(db)).Methods("PUT")
+	r.HandleFunc("/api/tenders/{tenderId}/owners/{organizationId}", tenders.RemoveOwnerHandler(db)).Methods("DELETE")
+	r.HandleFunc("/api/tenders/{tenderId}/invitations", tenders.InvitationsHandler(db)).Methods("GET")
+	r.HandleFunc("/api/tenders/{tenderId}/invitations/{organizationId}", tenders.InviteHandler(db)).Methods("PUT")
+	r.HandleFunc("/api/tenders/{tenderId}/invitations/{organizationId}", tenders.UninviteHandler(db)).Methods("DELETE")
 
-	r.HandleFunc("/api/bids/new", bids.NewBidHandler(db)).Methods("POST")
+	r.HandleFunc("/api/bids/new", idempotency_keys.Wrap(bids.NewBidHandler(db))).Methods("POST")
 	r.HandleFunc("/api/bids/my", bids.MyBidsHandler(db)).Methods("GET")
 
 	r.HandleFunc("/api/bids/{tenderId}/list", bids.ListBidsHandler(db)).Methods("GET")
+	r.HandleFunc("/api/bids/{tenderId}/list/export", bids.ExportBidsHandler(db)).Methods("GET")
+	r.HandleFunc("/api/bids/{tenderId}/reviews/export", bids.ExportReviewsHandler(db)).Methods("GET")
+	r.HandleFunc("/api/bids/{tenderId}/decisions/export", bids.ExportDecisionsHandler(db)).Methods("GET")
 	r.HandleFunc("/api/bids/{bidId}/status", bids.StatusBidsHandler(db)).Methods("GET", "PUT")
 	r.HandleFunc("/api/bids/{bidId}/edit", bids.EditBidsHandler(db)).Methods("PATCH")
 	r.HandleFunc("/api/bids/{bidId}/rollback/{version}", bids.RollbackBidsHandler(db)).Methods("PUT")
 	r.HandleFunc("/api/bids/{bidId}/feedback", bids.FeedbackHandler(db)).Methods("PUT")
 	r.HandleFunc("/api/bids/{tenderId}/reviews", bids.ReviewsHandler(db)).Methods("GET")
-	r.HandleFunc("/api/bids/{bidId}/submit_decision", bids.SubmitDecisionHandler(db)).Methods("PUT")
+	r.HandleFunc("/api/bids/{bidId}/submit_decision", bids.SubmitDecisionHandler(db, cfg.Bids.DecisionQuorum)).Methods("PUT")
+	r.HandleFunc("/api/bids/{bidId}/withdraw", bids.WithdrawBidHandler(db)).Methods("PUT")
+	r.HandleFunc("/api/bids/{bidId}/resubmit", bids.ResubmitBidHandler(db)).Methods("PUT")
+	r.HandleFunc("/api/bids/{bidId}/revisions", bids.RevisionsBidHandler(db)).Methods("GET")
+
+	r.HandleFunc("/api/tenders/{tenderId}/attachments", files.ListHandler(attachments.TenderEntity)).Methods("GET")
+	r.HandleFunc("/api/tenders/{tenderId}/attachments", files.UploadHandler(attachments.TenderEntity)).Methods("POST")
+	r.HandleFunc("/api/tenders/{tenderId}/attachments/{attachmentId}", files.DownloadHandler(attachments.TenderEntity)).Methods("GET")
+	r.HandleFunc("/api/bids/{bidId}/attachments", files.ListHandler(attachments.BidEntity)).Methods("GET")
+	r.HandleFunc("/api/bids/{bidId}/attachments", files.UploadHandler(attachments.BidEntity)).Methods("POST")
+	r.HandleFunc("/api/bids/{bidId}/attachments/{attachmentId}", files.DownloadHandler(attachments.BidEntity)).Methods("GET")
+
+	r.HandleFunc("/api/tenders/{tenderId}/questions", questions.QuestionsHandler(db)).Methods("GET")
+	r.HandleFunc("/api/tenders/{tenderId}/questions", questions.AskHandler(db)).Methods("POST")
+	r.HandleFunc("/api/tenders/{tenderId}/questions/{questionId}/answer", questions.AnswerHandler(db)).Methods("PUT")
 
-	http.Handle("/", r)
+	r.HandleFunc("/api/qualifications", qualifications.QualificationsHandler(db, cfg.Qualifications.Reviewers)).Methods("GET")
+	r.HandleFunc("/api/qualifications/new", qualifications.RequestHandler(db)).Methods("POST")
+	r.HandleFunc("/api/qualifications/{qualificationId}/review", qualifications.ReviewHandler(db, cfg.Qualifications.Reviewers)).Methods("PUT")
+
+	r.HandleFunc("/api/notifications", notifications.NotificationsHandler(db)).Methods("GET")
+	r.HandleFunc("/api/notifications/{notificationId}/read", notifications.ReadNotificationHandler(db)).Methods("PUT")
+
+	r.HandleFunc("/api/audit", audit.AuditHandler(db)).Methods("GET")
+	r.HandleFunc("/api/audit/verify", audit.VerifyHandler(db)).Methods("GET")
+
+	return r
 }
 
-func main() {
-	connStr := os.Getenv("POSTGRES_CONN")
-	db, err := sql.Open("postgres", connStr)
+// serveCommand applies the migrations and serves the API until SIGTERM.
+func serveCommand(env *cliEnv, flags *flag.FlagSet, args []string) int {
+	if !parseArgs(flags, args, 0) {
+		return 2
+	}
+	cfg, db := env.cfg, env.db
+	shutdown_tracing, err := tracing.Init(context.Background(), cfg.Tracing.Exporter)
 	if err != nil {
+		log.Fatal("tracing: ", err)
+	}
+	if err = migrations.Apply(db); err != nil {
+		log.Fatal("migrations: ", err)
+	}
+
+	if err = cache.Listen(env.ctx, cfg.Database.Conn); err != nil {
+		log.Fatal("cache: ", err)
+	}
+
+	checker := health.NewChecker(db)
+	server := &http.Server{
+		Addr:              cfg.Server.Address,
+		Handler:           httpSetHandlers(db, cfg, checker),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	server_err := make(chan error, 1)
+	go func() {
+		slog.Info("server started", "address", cfg.Server.Address)
+		server_err <- server.ListenAndServe()
+	}()
+
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+	select {
+	case err = <-server_err:
 		log.Fatal(err)
+	case <-stop.Done():
+	}
+
+	slog.Info("shutting down")
+	checker.SetDraining()
+	time.Sleep(cfg.Server.ShutdownDelay)
+	ctx, cancel_shutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel_shutdown()
+	if err = server.Shutdown(ctx); err != nil {
+		slog.Error("shutdown", "err", err)
+	}
+	if err = <-server_err; !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server", "err", err)
+	}
+	if err = shutdown_tracing(ctx); err != nil {
+		slog.Error("tracing shutdown", "err", err)
+	}
+	slog.Info("server stopped")
+	return 0
+}
+
+// main runs a subcommand of cli.go, serve without arguments.
+func main() {
+	cfg, args, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal("config:\n", err)
+	}
+	if err = logging.SetupStdout(cfg.Log.Level); err != nil {
+		log.Fatal("logging: ", err)
 	}
-	defer db.Close()
-	httpSetHandlers(db)
-	log.Println("Server running on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	os.Exit(runCommand(cfg, args, os.Stdout, os.Stderr))
 }
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route template and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	TendersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tenders_created_total",
+		Help: "Tenders created.",
+	})
+	TendersPublished = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tenders_published_total",
+		Help: "Tenders moved to the Published status.",
+	})
+	BidsSubmitted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bids_submitted_total",
+		Help: "Bids created.",
+	})
+	BidDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bid_decisions_total",
+		Help: "Decisions submitted on bids by outcome.",
+	}, []string{"decision"})
+	BidFeedback = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bid_feedback_total",
+		Help: "Feedback posted on bids.",
+	})
+	DBRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_retries_total",
+		Help: "Database operations retried after a transient error, by reason (conflict or connection).",
+	}, []string{"reason"})
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_lookups_total",
+		Help: "Lookups in the shared read cache, by result (hit or miss).",
+	}, []string{"result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		TendersCreated, TendersPublished, BidsSubmitted, BidDecisions, BidFeedback, DBRetries, CacheLookups,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of db.
+func RegisterDB(db *sql.DB) error {
+	err := registry.Register(collectors.NewDBStatsCollector(db, "postgres"))
+	var already_registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &already_registered) {
+		return nil
+	}
+	return err
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware labels requests with the mux route template, e.g.
+// /api/bids/{bidId}/status, so that IDs do not blow up the label set.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+	})
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMiddlewareUsesRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/api/bids/{bidId}/status", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Handle("/metrics", Handler())
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/bids/0b8f1b0e-5f5e-4c3a-9d2d-3f1e6b7a8c9d/status", nil))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	want := `http_requests_total{method="GET",route="/api/bids/{bidId}/status",status="404"} 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("metrics do not contain %s", want)
+	}
+	if strings.Contains(body, "0b8f1b0e") {
+		t.Error("metrics contain a raw path")
+	}
+}
@@ -0,0 +1,150 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go_server/m/common/dbhelp"
+)
+
+// The baseline schema is created by src/data_base/init.sql. Files in sql/
+// are named <version>_<name>.sql and applied once each, in version order.
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func List() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	var result []Migration
+	for _, entry := range entries {
+		file_name := entry.Name()
+		s_version, name, ok := strings.Cut(strings.TrimSuffix(file_name, ".sql"), "_")
+		version, err := strconv.Atoi(s_version)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>.sql", file_name)
+		}
+		data, err := fs.ReadFile(files, "sql/"+file_name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, Migration{Version: version, Name: name, SQL: string(data)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+func applied(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}) (map[int]bool, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		result[version] = true
+	}
+	return result, rows.Err()
+}
+
+// Apply creates schema_migrations if needed and runs every migration that is
+// not recorded there yet, each in its own transaction.
+func Apply(db *sql.DB) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, dbhelp.LockMigrations); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, dbhelp.LockMigrations)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	migrations, err := List()
+	if err != nil {
+		return err
+	}
+	done, err := applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		if done[migration.Version] {
+			continue
+		}
+		if err := apply(ctx, conn, migration); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		slog.Info("migration applied", "version", migration.Version, "name", migration.Name)
+	}
+	return nil
+}
+
+func apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, migration.SQL); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+		migration.Version, migration.Name)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Pending returns the versions that are embedded in the binary but not
+// applied to the database.
+func Pending(ctx context.Context, db *sql.DB) ([]int, error) {
+	migrations, err := List()
+	if err != nil {
+		return nil, err
+	}
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var result []int
+	for _, migration := range migrations {
+		if !done[migration.Version] {
+			result = append(result, migration.Version)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,9 @@
+-- The baseline schema comes from src/data_base/init.sql. This migration only
+-- checks that it has been loaded, so later migrations have something to alter.
+DO $$
+BEGIN
+    IF to_regclass('tenders') IS NULL OR to_regclass('bids') IS NULL THEN
+        RAISE EXCEPTION 'baseline schema from init.sql is missing';
+    END IF;
+END
+$$;
@@ -0,0 +1,9 @@
+-- Each bids_archive row is a past version of a bid and the event that
+-- replaced it: edit, rollback, withdraw or resubmit.
+ALTER TABLE bids_archive
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS event VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS reason VARCHAR(500),
+    ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS bids_archive_id_version ON bids_archive (id, version);
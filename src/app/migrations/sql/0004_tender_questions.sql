@@ -0,0 +1,28 @@
+-- Clarification questions of suppliers on tenders and the answers of the
+-- tender organization. visibility is set when the question is answered.
+CREATE TABLE IF NOT EXISTS tender_questions (
+    id SERIAL PRIMARY KEY,
+    tender_id UUID NOT NULL,
+    author_id INT NOT NULL REFERENCES employee(id),
+    question VARCHAR(1000) NOT NULL,
+    answer VARCHAR(2000),
+    answered_by INT REFERENCES employee(id),
+    visibility VARCHAR(20) CHECK (visibility IN ('public', 'private')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    answered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS tender_questions_tender_id ON tender_questions (tender_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    recipient_id INT NOT NULL REFERENCES employee(id),
+    kind VARCHAR(50) NOT NULL,
+    tender_id UUID,
+    question_id INT,
+    message VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS notifications_recipient ON notifications (recipient_id, id);
@@ -0,0 +1,17 @@
+-- Files attached to a tender or bid version. The content lives in the blob
+-- store under storage_key; the row is written only after the upload succeeded.
+CREATE TABLE IF NOT EXISTS attachments (
+    id UUID PRIMARY KEY,
+    entity_type VARCHAR(20) NOT NULL CHECK (entity_type IN ('tender', 'bid')),
+    entity_id UUID NOT NULL,
+    entity_version INT NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    storage_key VARCHAR(300) NOT NULL UNIQUE,
+    uploaded_by INT NOT NULL REFERENCES employee(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS attachments_entity ON attachments (entity_type, entity_id, entity_version);
@@ -0,0 +1,12 @@
+-- Organizations running a tender together with the tender organization.
+-- Their responsible employees see the tender and its bids; rights lists what
+-- else they may do, the tender organization may do everything.
+CREATE TABLE IF NOT EXISTS tender_owners (
+    tender_id UUID NOT NULL REFERENCES tenders(id) ON DELETE CASCADE,
+    organization_id INT NOT NULL REFERENCES organization(id) ON DELETE CASCADE,
+    rights TEXT[] NOT NULL DEFAULT '{}' CHECK (rights <@ ARRAY['edit', 'status', 'bids']::TEXT[]),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tender_id, organization_id)
+);
+
+CREATE INDEX IF NOT EXISTS tender_owners_organization_id ON tender_owners (organization_id);
@@ -0,0 +1,16 @@
+-- Who sees a tender besides its organizations: everyone when public, the
+-- invited organizations when invite_only, nobody when internal.
+ALTER TABLE tenders ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'invite_only', 'internal'));
+
+-- Suppliers invited to an invite_only tender. Invitations are kept when the
+-- visibility changes, so they apply again once it is invite_only.
+CREATE TABLE IF NOT EXISTS tender_invitations (
+    tender_id UUID NOT NULL REFERENCES tenders(id) ON DELETE CASCADE,
+    organization_id INT NOT NULL REFERENCES organization(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tender_id, organization_id)
+);
+
+CREATE INDEX IF NOT EXISTS tender_invitations_organization_id ON tender_invitations (organization_id);
+CREATE INDEX IF NOT EXISTS tenders_visibility ON tenders (visibility);
@@ -0,0 +1,24 @@
+-- Pre-qualification of supplier organizations per service type. A
+-- qualification counts once a reviewer approved it and only between
+-- valid_from and valid_until inclusive.
+CREATE TABLE IF NOT EXISTS supplier_qualifications (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL REFERENCES organization(id) ON DELETE CASCADE,
+    service_type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'Pending' CHECK (status IN ('Pending', 'Approved', 'Rejected')),
+    valid_from DATE NOT NULL,
+    valid_until DATE NOT NULL,
+    requested_by INT NOT NULL REFERENCES employee(id),
+    reviewed_by INT REFERENCES employee(id),
+    comment TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at TIMESTAMP,
+    CHECK (valid_until >= valid_from)
+);
+
+-- One request under review per organization and service type.
+CREATE UNIQUE INDEX IF NOT EXISTS supplier_qualifications_pending
+    ON supplier_qualifications (organization_id, service_type) WHERE status = 'Pending';
+
+-- Tenders that only accept bids from qualified suppliers.
+ALTER TABLE tenders ADD COLUMN IF NOT EXISTS requires_qualification BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,30 @@
+-- The audit log used to be created by init.sql; databases created from it
+-- already have the table, so everything here is idempotent.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(50) NOT NULL,
+    organization_id INT,
+    entity_type VARCHAR(20) NOT NULL,
+    entity_id VARCHAR(100) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    before_data JSON,
+    after_data JSON,
+    request_id VARCHAR(100),
+    created_at TIMESTAMP NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) UNIQUE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_org_created_idx ON audit_log (organization_id, created_at);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
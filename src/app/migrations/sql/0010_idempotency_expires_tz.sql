@@ -0,0 +1,5 @@
+-- expires_at is compared with now() in SQL, keep it zone aware. Existing
+-- values are taken in the session time zone; they expire within the TTL anyway.
+ALTER TABLE idempotency_keys
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
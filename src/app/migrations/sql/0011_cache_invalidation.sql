@@ -0,0 +1,51 @@
+-- Users and the organizations they are responsible for are kept in the
+-- shared cache. Their changes, also those made directly in the database,
+-- drop the cached values in every process listening on cache_invalidation.
+-- The keys are those of dbhelp; '*' clears the whole cache.
+CREATE OR REPLACE FUNCTION organization_responsible_invalidate() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'TRUNCATE' THEN
+        PERFORM pg_notify('cache_invalidation', '*');
+        RETURN NULL;
+    END IF;
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM pg_notify('cache_invalidation', 'organizations:' || OLD.user_id);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM pg_notify('cache_invalidation', 'organizations:' || NEW.user_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS organization_responsible_invalidate ON organization_responsible;
+CREATE TRIGGER organization_responsible_invalidate
+    AFTER INSERT OR UPDATE OR DELETE ON organization_responsible
+    FOR EACH ROW EXECUTE FUNCTION organization_responsible_invalidate();
+
+DROP TRIGGER IF EXISTS organization_responsible_truncate_invalidate ON organization_responsible;
+CREATE TRIGGER organization_responsible_truncate_invalidate
+    AFTER TRUNCATE ON organization_responsible
+    FOR EACH STATEMENT EXECUTE FUNCTION organization_responsible_invalidate();
+
+CREATE OR REPLACE FUNCTION employee_invalidate() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'TRUNCATE' THEN
+        PERFORM pg_notify('cache_invalidation', '*');
+        RETURN NULL;
+    END IF;
+    PERFORM pg_notify('cache_invalidation', 'user_id:' || OLD.username);
+    PERFORM pg_notify('cache_invalidation', 'user_name:' || OLD.id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS employee_invalidate ON employee;
+CREATE TRIGGER employee_invalidate
+    AFTER UPDATE OR DELETE ON employee
+    FOR EACH ROW EXECUTE FUNCTION employee_invalidate();
+
+DROP TRIGGER IF EXISTS employee_truncate_invalidate ON employee;
+CREATE TRIGGER employee_truncate_invalidate
+    AFTER TRUNCATE ON employee
+    FOR EACH STATEMENT EXECUTE FUNCTION employee_invalidate();
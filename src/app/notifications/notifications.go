@@ -0,0 +1,133 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	KindQuestionAsked    = "question.asked"
+	KindQuestionAnswered = "question.answered"
+)
+
+type Notification struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	TenderID   *uuid.UUID `json:"tender_id,omitempty"`
+	QuestionID *int       `json:"question_id,omitempty"`
+	Message    string     `json:"message"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+}
+
+// Notify stores the same notification for every recipient, once each.
+func Notify(ctx context.Context, db *sql.DB, recipient_ids []int, notification Notification) errinfo.ErrorInfo {
+	if len(recipient_ids) == 0 {
+		return errinfo.Ok()
+	}
+	query := `
+		INSERT INTO notifications (recipient_id, kind, tender_id, question_id, message)
+		SELECT DISTINCT recipient_id, $2, $3, $4, $5
+		FROM unnest($1::int[]) AS recipient_id
+	`
+	_, err := db.ExecContext(ctx, query, pq.Array(recipient_ids), notification.Kind, notification.TenderID,
+		notification.QuestionID, notification.Message)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+}
+
+func getNotifications(ctx context.Context, db *sql.DB, user_id int, unread_only bool, limit, offset int) ([]Notification, errinfo.ErrorInfo) {
+	query := `
+		SELECT id, kind, tender_id, question_id, message, created_at, read_at
+		FROM notifications
+		WHERE recipient_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY id DESC
+		LIMIT $3
+		OFFSET $4
+	`
+	rows, err := db.QueryContext(ctx, query, user_id, unread_only, limit, offset)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+
+	result := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(&notification.ID, &notification.Kind, &notification.TenderID, &notification.QuestionID,
+			&notification.Message, &notification.CreatedAt, &notification.ReadAt)
+		if err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		result = append(result, notification)
+	}
+	return result, dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
+}
+
+func markRead(ctx context.Context, db *sql.DB, user_id int, notification_id int64) (notification Notification, err_info errinfo.ErrorInfo) {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND recipient_id = $2
+		RETURNING id, kind, tender_id, question_id, message, created_at, read_at
+	`
+	err := db.QueryRowContext(ctx, query, notification_id, user_id).Scan(&notification.ID, &notification.Kind,
+		&notification.TenderID, &notification.QuestionID, &notification.Message, &notification.CreatedAt, &notification.ReadAt)
+	err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeNotificationNotFound)
+	return
+}
+
+// NotificationsHandler lists the notifications of the user, newest first.
+func NotificationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_id, err_info := dbhelp.GetUserId(r.Context(), db, r.URL.Query().Get("username"))
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		result, err_info := getNotifications(r.Context(), db, user_id, r.URL.Query().Get("unread") == "true", limit, offset)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func ReadNotificationHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notification_id, err_info := helpers.Atoi(mux.Vars(r)["notificationId"])
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_id, err_info := dbhelp.GetUserId(r.Context(), db, r.URL.Query().Get("username"))
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		notification, err_info := markRead(r.Context(), db, user_id, int64(notification_id))
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(notification)
+	}
+}
@@ -0,0 +1,183 @@
+package qualifications
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+)
+
+const (
+	StatusPending  = "Pending"
+	StatusApproved = "Approved"
+	StatusRejected = "Rejected"
+)
+
+// dateLayout is that of validFrom and validUntil.
+const dateLayout = "2006-01-02"
+
+// Qualification states that a supplier organization may bid on tenders of
+// the service type that require it, once approved and while valid.
+type Qualification struct {
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organizationId"`
+	ServiceType    string     `json:"serviceType"`
+	Status         string     `json:"status"`
+	ValidFrom      string     `json:"validFrom"`
+	ValidUntil     string     `json:"validUntil"`
+	Comment        string     `json:"comment,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ReviewedAt     *time.Time `json:"reviewedAt,omitempty"`
+}
+
+type requestBody struct {
+	OrganizationID int    `json:"organizationId"`
+	ServiceType    string `json:"serviceType"`
+	ValidFrom      string `json:"validFrom"`
+	ValidUntil     string `json:"validUntil"`
+}
+
+type reviewBody struct {
+	Decision string `json:"decision"`
+	Comment  string `json:"comment"`
+}
+
+// validate checks the fields the schema can't: the dates must be in order
+// and the qualification must not have expired already.
+func (req *requestBody) validate(today time.Time) errinfo.ErrorInfo {
+	err_info := errinfo.New(errinfo.CodeValidationFailed)
+	if req.ServiceType == "" || !helpers.IsOkServiceType(req.ServiceType) {
+		err_info = err_info.WithField("serviceType", "Unknown service type.")
+	}
+	valid_from, from_err := time.Parse(dateLayout, req.ValidFrom)
+	if from_err != nil {
+		err_info = err_info.WithField("validFrom", "Must be a date such as 2026-01-31.")
+	}
+	valid_until, until_err := time.Parse(dateLayout, req.ValidUntil)
+	if until_err != nil {
+		err_info = err_info.WithField("validUntil", "Must be a date such as 2026-01-31.")
+	} else if from_err == nil && valid_until.Before(valid_from) {
+		err_info = err_info.WithField("validUntil", "Must not be before validFrom.")
+	} else if valid_until.Format(dateLayout) < today.Format(dateLayout) {
+		err_info = err_info.WithField("validUntil", "Must not be in the past.")
+	}
+	if len(err_info.Fields) != 0 {
+		return err_info
+	}
+	return errinfo.Ok()
+}
+
+const qualificationColumns = `id, organization_id, service_type, status,
+	to_char(valid_from, 'YYYY-MM-DD'), to_char(valid_until, 'YYYY-MM-DD'),
+	COALESCE(comment, ''), created_at, reviewed_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanQualification(row scanner) (qualification Qualification, err error) {
+	err = row.Scan(&qualification.ID, &qualification.OrganizationID, &qualification.ServiceType,
+		&qualification.Status, &qualification.ValidFrom, &qualification.ValidUntil,
+		&qualification.Comment, &qualification.CreatedAt, &qualification.ReviewedAt)
+	return
+}
+
+// createQualification files a request for review, one at a time per
+// organization and service type.
+func createQualification(ctx context.Context, db dbhelp.Querier, qualification *Qualification, requested_by int) errinfo.ErrorInfo {
+	query := `
+		INSERT INTO supplier_qualifications (organization_id, service_type, valid_from, valid_until, requested_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (organization_id, service_type) WHERE status = 'Pending' DO NOTHING
+		RETURNING id, status, created_at`
+	err := db.QueryRowContext(ctx, query, qualification.OrganizationID, qualification.ServiceType,
+		qualification.ValidFrom, qualification.ValidUntil, requested_by).
+		Scan(&qualification.ID, &qualification.Status, &qualification.CreatedAt)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeAlreadyExists)
+}
+
+func getQualification(ctx context.Context, db *sql.DB, qualification_id int) (*Qualification, errinfo.ErrorInfo) {
+	query := `SELECT ` + qualificationColumns + ` FROM supplier_qualifications WHERE id = $1`
+	qualification, err := scanQualification(db.QueryRowContext(ctx, query, qualification_id))
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeQualificationNotFound)
+	}
+	return &qualification, errinfo.Ok()
+}
+
+// reviewQualification only decides on a pending request, so concurrent
+// reviews do not overwrite each other.
+func reviewQualification(ctx context.Context, db dbhelp.Querier, qualification *Qualification, reviewed_by int) errinfo.ErrorInfo {
+	query := `
+		UPDATE supplier_qualifications
+		SET status = $1, comment = NULLIF($2, ''), reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND status = 'Pending'
+		RETURNING reviewed_at`
+	err := db.QueryRowContext(ctx, query, qualification.Status, qualification.Comment, reviewed_by, qualification.ID).
+		Scan(&qualification.ReviewedAt)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeQualificationReviewed)
+}
+
+// getQualifications returns every qualification to a reviewer, and to
+// others those of the organizations they are responsible for.
+func getQualifications(ctx context.Context, db *sql.DB, user_id int, is_reviewer bool, organization_id int, status string, limit, offset int) ([]Qualification, errinfo.ErrorInfo) {
+	query := `
+		SELECT ` + qualificationColumns + `
+		FROM supplier_qualifications
+		WHERE ($1 OR organization_id IN (SELECT organization_id FROM organization_responsible WHERE user_id = $2))
+		  AND ($3 = 0 OR organization_id = $3)
+		  AND ($4 = '' OR status = $4)
+		ORDER BY id
+		LIMIT $5
+		OFFSET $6
+	`
+	rows, err := db.QueryContext(ctx, query, is_reviewer, user_id, organization_id, status, limit, offset)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+
+	result := []Qualification{}
+	for rows.Next() {
+		qualification, err := scanQualification(rows)
+		if err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		result = append(result, qualification)
+	}
+	return result, dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
+}
+
+// validCondition selects the approved qualifications valid today.
+const validCondition = `q.status = 'Approved' AND q.service_type = $2
+	AND q.valid_from <= CURRENT_DATE AND q.valid_until >= CURRENT_DATE`
+
+// IsQualified tells whether the organization holds a valid qualification
+// for the service type.
+func IsQualified(ctx context.Context, db *sql.DB, organization_id int, service_type string) (bool, errinfo.ErrorInfo) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM supplier_qualifications q
+			WHERE q.organization_id = $1 AND ` + validCondition + `
+		)`
+	var qualified bool
+	err := db.QueryRowContext(ctx, query, organization_id, service_type).Scan(&qualified)
+	return qualified, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+}
+
+// IsUserQualified tells whether one of the organizations the user is
+// responsible for holds a valid qualification for the service type.
+func IsUserQualified(ctx context.Context, db *sql.DB, user_id int, service_type string) (bool, errinfo.ErrorInfo) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM supplier_qualifications q
+			JOIN organization_responsible orgr ON orgr.organization_id = q.organization_id
+			WHERE orgr.user_id = $1 AND ` + validCondition + `
+		)`
+	var qualified bool
+	err := db.QueryRowContext(ctx, query, user_id, service_type).Scan(&qualified)
+	return qualified, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+}
@@ -0,0 +1,170 @@
+package qualifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"go_server/m/audit"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+
+	"github.com/gorilla/mux"
+)
+
+func sendJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// RequestHandler lets a responsible employee of a supplier organization
+// ask for a qualification, which stays pending until a reviewer decides.
+func RequestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req_body requestBody
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
+			return
+		}
+		if err_info := req_body.validate(time.Now()); err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_name := r.URL.Query().Get("username")
+		if _, err_info := dbhelp.GetOrganization(r.Context(), db, req_body.OrganizationID); err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_id, err_info := dbhelp.IsUserExistAndResponsible(r.Context(), db, user_name, req_body.OrganizationID)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+
+		qualification := &Qualification{OrganizationID: req_body.OrganizationID, ServiceType: req_body.ServiceType,
+			ValidFrom: req_body.ValidFrom, ValidUntil: req_body.ValidUntil}
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := createQualification(r.Context(), tx, qualification, user_id); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: qualification.OrganizationID,
+				EntityType:     audit.EntityQualification,
+				EntityID:       strconv.Itoa(qualification.ID),
+				Action:         audit.ActionQualificationRequest,
+				After:          qualification,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		sendJSON(w, qualification)
+	}
+}
+
+// QualificationsHandler lists every qualification to the reviewers, and to
+// others those of their organizations.
+func QualificationsHandler(db *sql.DB, reviewers []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		organization_id := 0
+		if s_organization_id := r.URL.Query().Get("organizationId"); s_organization_id != "" {
+			if organization_id, err_info = helpers.Atoi(s_organization_id); err_info.Status != 200 {
+				errinfo.SendHttpErr(w, err_info.WithField("organizationId", err_info.Reason))
+				return
+			}
+		}
+		user_name := r.URL.Query().Get("username")
+		user_id, err_info := dbhelp.GetUserId(r.Context(), db, user_name)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		result, err_info := getQualifications(r.Context(), db, user_id, slices.Contains(reviewers, user_name),
+			organization_id, r.URL.Query().Get("status"), limit, offset)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		sendJSON(w, result)
+	}
+}
+
+// ReviewHandler lets a reviewer approve or reject a pending qualification,
+// except one of an organization they are responsible for.
+func ReviewHandler(db *sql.DB, reviewers []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req_body reviewBody
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
+			return
+		}
+		if req_body.Decision != StatusApproved && req_body.Decision != StatusRejected {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeValidationFailed).
+				WithField("decision", "Must be Approved or Rejected."))
+			return
+		}
+		qualification_id, err_info := helpers.Atoi(mux.Vars(r)["qualificationId"])
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_name := r.URL.Query().Get("username")
+		user_id, err_info := dbhelp.GetUserId(r.Context(), db, user_name)
+		if err_info.Status == 200 && !slices.Contains(reviewers, user_name) {
+			err_info = errinfo.New(errinfo.CodeNoPermission)
+		}
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		qualification, err_info := getQualification(r.Context(), db, qualification_id)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		err_info = dbhelp.IsUserInOrganization(r.Context(), db, user_id, qualification.OrganizationID)
+		if err_info.Status == 200 {
+			err_info = errinfo.New(errinfo.CodeNoPermission)
+		} else if err_info.Code == errinfo.CodeNoPermission {
+			err_info = errinfo.Ok()
+		}
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+
+		before := *qualification
+		qualification.Status = req_body.Decision
+		qualification.Comment = req_body.Comment
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := reviewQualification(r.Context(), tx, qualification, user_id); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: qualification.OrganizationID,
+				EntityType:     audit.EntityQualification,
+				EntityID:       strconv.Itoa(qualification.ID),
+				Action:         audit.ActionQualificationReview,
+				Before:         before,
+				After:          qualification,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		sendJSON(w, qualification)
+	}
+}
@@ -0,0 +1,34 @@
+package qualifications
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestValidate(t *testing.T) {
+	today := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name  string
+		req   requestBody
+		field string
+	}{
+		{"valid", requestBody{ServiceType: "Delivery", ValidFrom: "2026-01-01", ValidUntil: "2026-03-10"}, ""},
+		{"unknown service type", requestBody{ServiceType: "Cleaning", ValidFrom: "2026-01-01", ValidUntil: "2026-12-31"}, "serviceType"},
+		{"no service type", requestBody{ValidFrom: "2026-01-01", ValidUntil: "2026-12-31"}, "serviceType"},
+		{"bad date", requestBody{ServiceType: "Delivery", ValidFrom: "01.01.2026", ValidUntil: "2026-12-31"}, "validFrom"},
+		{"reversed", requestBody{ServiceType: "Delivery", ValidFrom: "2026-12-31", ValidUntil: "2026-06-01"}, "validUntil"},
+		{"expired", requestBody{ServiceType: "Delivery", ValidFrom: "2025-01-01", ValidUntil: "2026-03-09"}, "validUntil"},
+	}
+	for _, c := range cases {
+		err_info := c.req.validate(today)
+		if c.field == "" {
+			if err_info.Status != 200 {
+				t.Errorf("%s: %v %v", c.name, err_info.Code, err_info.Fields)
+			}
+			continue
+		}
+		if err_info.Status != 400 || len(err_info.Fields) != 1 || err_info.Fields[0].Field != c.field {
+			t.Errorf("%s: status %d, fields %v, want %s", c.name, err_info.Status, err_info.Fields, c.field)
+		}
+	}
+}
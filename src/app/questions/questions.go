@@ -0,0 +1,185 @@
+package questions
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/tenders"
+
+	"github.com/google/uuid"
+)
+
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+type Question struct {
+	ID         int        `json:"id"`
+	TenderID   uuid.UUID  `json:"tender_id"`
+	AuthorID   int        `json:"author_id,omitempty"`
+	Question   string     `json:"question"`
+	Answer     string     `json:"answer,omitempty"`
+	Visibility string     `json:"visibility,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AnsweredAt *time.Time `json:"answered_at,omitempty"`
+}
+
+type askRequestBody struct {
+	Question string `json:"question"`
+}
+
+type answerRequestBody struct {
+	Answer     string `json:"answer"`
+	Visibility string `json:"visibility"`
+}
+
+const questionColumns = `id, tender_id, author_id, question, COALESCE(answer, ''), COALESCE(visibility, ''), created_at, answered_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanQuestion(row scanner) (question Question, err error) {
+	err = row.Scan(&question.ID, &question.TenderID, &question.AuthorID, &question.Question,
+		&question.Answer, &question.Visibility, &question.CreatedAt, &question.AnsweredAt)
+	return
+}
+
+func createQuestion(ctx context.Context, db dbhelp.Querier, question *Question) errinfo.ErrorInfo {
+	query := `
+		INSERT INTO tender_questions (tender_id, author_id, question)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+	err := db.QueryRowContext(ctx, query, question.TenderID, question.AuthorID, question.Question).
+		Scan(&question.ID, &question.CreatedAt)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+}
+
+func getQuestion(ctx context.Context, db *sql.DB, tender_id uuid.UUID, question_id int) (*Question, errinfo.ErrorInfo) {
+	query := `SELECT ` + questionColumns + ` FROM tender_questions WHERE id = $1 AND tender_id = $2`
+	question, err := scanQuestion(db.QueryRowContext(ctx, query, question_id, tender_id))
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeQuestionNotFound)
+	}
+	return &question, errinfo.Ok()
+}
+
+// answerQuestion only answers a question once, so concurrent answers do not
+// overwrite each other.
+func answerQuestion(ctx context.Context, db dbhelp.Querier, question *Question, answered_by int) errinfo.ErrorInfo {
+	query := `
+		UPDATE tender_questions
+		SET answer = $1, visibility = $2, answered_by = $3, answered_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND answer IS NULL
+		RETURNING answered_at`
+	err := db.QueryRowContext(ctx, query, question.Answer, question.Visibility, answered_by, question.ID).Scan(&question.AnsweredAt)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeQuestionAnswered)
+}
+
+// getQuestions returns every question to the tender organization, and to a
+// supplier the public answers and their own questions.
+func getQuestions(ctx context.Context, db *sql.DB, tender_id uuid.UUID, user_id int, is_owner bool, limit, offset int) ([]Question, errinfo.ErrorInfo) {
+	query := `
+		SELECT ` + questionColumns + `
+		FROM tender_questions
+		WHERE tender_id = $1 AND ($2 OR visibility = 'public' OR author_id = $3)
+		ORDER BY id
+		LIMIT $4
+		OFFSET $5
+	`
+	rows, err := db.QueryContext(ctx, query, tender_id, is_owner, user_id, limit, offset)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+
+	result := []Question{}
+	for rows.Next() {
+		question, err := scanQuestion(rows)
+		if err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		if !is_owner && question.AuthorID != user_id {
+			question.AuthorID = 0
+		}
+		result = append(result, question)
+	}
+	return result, dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
+}
+
+// getBidderIds returns the employees who placed bids on the tender, and
+// those of the organizations that did.
+func getBidderIds(ctx context.Context, db *sql.DB, tender_id uuid.UUID) ([]int, errinfo.ErrorInfo) {
+	query := `
+	SELECT author_id FROM bids WHERE tender_id = $1 AND author_type = 'User'
+	UNION
+	SELECT orgr.user_id
+	FROM bids b
+	JOIN organization_responsible orgr ON orgr.organization_id = b.author_id
+	WHERE b.tender_id = $1 AND b.author_type = 'Organization'
+	`
+	rows, err := db.QueryContext(ctx, query, tender_id)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+	var result []int
+	for rows.Next() {
+		var author_id int
+		if err := rows.Scan(&author_id); err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		result = append(result, author_id)
+	}
+	return result, dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
+}
+
+// getResponsibleIds returns the employees responsible for the tender
+// organization or for one of its co-owners.
+func getResponsibleIds(ctx context.Context, db *sql.DB, tender_id uuid.UUID) ([]int, errinfo.ErrorInfo) {
+	query := `
+	SELECT DISTINCT orgr.user_id
+	FROM organization_responsible orgr
+	WHERE orgr.organization_id IN (
+		SELECT t.organization_id FROM tenders t WHERE t.id = $1
+		UNION
+		SELECT o.organization_id FROM tender_owners o WHERE o.tender_id = $1
+	)
+	`
+	rows, err := db.QueryContext(ctx, query, tender_id)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+	var result []int
+	for rows.Next() {
+		var user_id int
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		result = append(result, user_id)
+	}
+	return result, dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
+}
+
+// getTenderForUser loads the tender and the user, who need not be
+// responsible for any of the tender organizations but must see the tender.
+func getTenderForUser(ctx context.Context, db *sql.DB, s_tender_id, user_name string) (*tenders.Access, errinfo.ErrorInfo) {
+	tender_id, err_info := helpers.ParseUUID(s_tender_id)
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	access, err_info := tenders.GetAccess(ctx, db, user_name, tender_id)
+	if err_info.Status == 200 {
+		err_info = access.Err()
+	}
+	if err_info.Code == errinfo.CodeNoPermission {
+		err_info = access.VisibleErr()
+	}
+	return access, err_info
+}
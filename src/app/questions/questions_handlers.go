@@ -0,0 +1,172 @@
+package questions
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"go_server/m/audit"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+	"go_server/m/notifications"
+	"go_server/m/tenders"
+
+	"github.com/gorilla/mux"
+)
+
+func sendJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// AskHandler lets an employee outside the tender organizations ask about a
+// published tender. The tender organizations are notified.
+func AskHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req_body askRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
+			return
+		}
+		user_name := r.URL.Query().Get("username")
+		access, err_info := getTenderForUser(r.Context(), db, mux.Vars(r)["tenderId"], user_name)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		tender, user_id := access.Tender, access.UserID
+		if access.Responsible {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeNoPermission))
+			return
+		}
+		if tender.Status != "Published" {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeTenderNotPublished))
+			return
+		}
+
+		question := &Question{TenderID: tender.ID, AuthorID: user_id, Question: req_body.Question}
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := createQuestion(r.Context(), tx, question); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderQuestion,
+				After:          question,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		responsible_ids, err_info := getResponsibleIds(r.Context(), db, tender.ID)
+		if err_info.Status == 200 {
+			notifications.Notify(r.Context(), db, responsible_ids, notifications.Notification{
+				Kind:       notifications.KindQuestionAsked,
+				TenderID:   &tender.ID,
+				QuestionID: &question.ID,
+				Message:    "New question on tender " + tender.Name,
+			})
+		}
+		sendJSON(w, question)
+	}
+}
+
+// AnswerHandler lets the tender organizations with tenders.RightEdit answer
+// a question once. A public answer is announced to the asker and every
+// bidder, a private one only to the asker.
+func AnswerHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req_body answerRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
+			return
+		}
+		vars := mux.Vars(r)
+		question_id, err_info := helpers.Atoi(vars["questionId"])
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_name := r.URL.Query().Get("username")
+		access, err_info := getTenderForUser(r.Context(), db, vars["tenderId"], user_name)
+		if err_info.Status == 200 {
+			err_info = access.Allow(tenders.RightEdit)
+		}
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		tender, user_id := access.Tender, access.UserID
+		question, err_info := getQuestion(r.Context(), db, tender.ID, question_id)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+
+		before := *question
+		question.Answer = req_body.Answer
+		question.Visibility = req_body.Visibility
+		if question.Visibility == "" {
+			question.Visibility = VisibilityPublic
+		}
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := answerQuestion(r.Context(), tx, question, user_id); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderAnswer,
+				Before:         before,
+				After:          question,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+
+		recipient_ids := []int{question.AuthorID}
+		if question.Visibility == VisibilityPublic {
+			bidder_ids, err_info := getBidderIds(r.Context(), db, tender.ID)
+			if err_info.Status == 200 {
+				recipient_ids = append(recipient_ids, bidder_ids...)
+			}
+		}
+		notifications.Notify(r.Context(), db, recipient_ids, notifications.Notification{
+			Kind:       notifications.KindQuestionAnswered,
+			TenderID:   &tender.ID,
+			QuestionID: &question.ID,
+			Message:    "Question on tender " + tender.Name + " is answered",
+		})
+		sendJSON(w, question)
+	}
+}
+
+func QuestionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		access, err_info := getTenderForUser(r.Context(), db, mux.Vars(r)["tenderId"], r.URL.Query().Get("username"))
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		result, err_info := getQuestions(r.Context(), db, access.Tender.ID, access.UserID, access.Responsible, limit, offset)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		sendJSON(w, result)
+	}
+}
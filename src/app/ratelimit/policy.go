@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Who a bucket belongs to.
+const (
+	KeyUser         = "user"
+	KeyOrganization = "organization"
+	KeyIP           = "ip"
+)
+
+// Policy allows Burst requests at once and refills at Rate per second.
+type Policy struct {
+	Key   string
+	Rate  float64
+	Burst int
+}
+
+// DefaultRoutes protect the endpoints that create or decide on things.
+var DefaultRoutes = map[string]Policy{
+	"POST /api/tenders/new":                 {Key: KeyUser, Rate: 30.0 / 60, Burst: 10},
+	"POST /api/bids/new":                    {Key: KeyUser, Rate: 20.0 / 60, Burst: 5},
+	"PUT /api/bids/{bidId}/submit_decision": {Key: KeyUser, Rate: 30.0 / 60, Burst: 10},
+	"PUT /api/bids/{bidId}/feedback":        {Key: KeyUser, Rate: 30.0 / 60, Burst: 10},
+}
+
+// ParsePolicy reads "<key>:<count>/<period>[:<burst>]", e.g. "user:20/1m:5"
+// is 20 requests a minute per user with at most 5 at once. Burst defaults
+// to count.
+func ParsePolicy(s string) (Policy, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Policy{}, fmt.Errorf("policy %q: want <key>:<count>/<period>[:<burst>]", s)
+	}
+	policy := Policy{Key: parts[0]}
+	switch policy.Key {
+	case KeyUser, KeyOrganization, KeyIP:
+	default:
+		return Policy{}, fmt.Errorf("policy %q: key must be user, organization or ip", s)
+	}
+	s_count, s_period, ok := strings.Cut(parts[1], "/")
+	count, err := strconv.Atoi(s_count)
+	if !ok || err != nil || count <= 0 {
+		return Policy{}, fmt.Errorf("policy %q: count must be a positive number", s)
+	}
+	if s_period != "" && !strings.ContainsAny(s_period[:1], "0123456789") {
+		s_period = "1" + s_period
+	}
+	period, err := time.ParseDuration(s_period)
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("policy %q: bad period %q", s, s_period)
+	}
+	policy.Rate = float64(count) / period.Seconds()
+	policy.Burst = count
+	if len(parts) == 3 {
+		if policy.Burst, err = strconv.Atoi(parts[2]); err != nil || policy.Burst <= 0 {
+			return Policy{}, fmt.Errorf("policy %q: burst must be a positive number", s)
+		}
+	}
+	return policy, nil
+}
+
+// ParseRoutes applies "<METHOD> <route template>=<policy>;..." on top of
+// DefaultRoutes. The policy "off" removes the limit from a route.
+func ParseRoutes(s string) (map[string]Policy, error) {
+	routes := map[string]Policy{}
+	for route, policy := range DefaultRoutes {
+		routes[route] = policy
+	}
+	for _, item := range strings.Split(s, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		route, s_policy, ok := strings.Cut(item, "=")
+		route = strings.Join(strings.Fields(route), " ")
+		if !ok || len(strings.Fields(route)) != 2 {
+			return nil, fmt.Errorf("route limit %q: want <METHOD> <route>=<policy>", item)
+		}
+		if strings.TrimSpace(s_policy) == "off" {
+			delete(routes, route)
+			continue
+		}
+		policy, err := ParsePolicy(s_policy)
+		if err != nil {
+			return nil, err
+		}
+		routes[route] = policy
+	}
+	return routes, nil
+}
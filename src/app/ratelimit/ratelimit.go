@@ -0,0 +1,227 @@
+package ratelimit
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/logging"
+
+	"github.com/gorilla/mux"
+)
+
+// Limiter applies a Policy per route template. Routes without a policy use
+// the fallback one, or are not limited if there is none. Before a user or
+// organization policy looks the user up, the client IP is limited by the
+// client policy, if any.
+type Limiter struct {
+	store    Store
+	db       *sql.DB
+	routes   map[string]Policy
+	fallback *Policy
+	client   *Policy
+	proxies  []netip.Prefix
+	now      func() time.Time
+}
+
+// NewLimiter takes the client IP from X-Forwarded-For when the request comes
+// from one of the trusted proxies.
+func NewLimiter(store Store, db *sql.DB, routes map[string]Policy, fallback, client *Policy, proxies []netip.Prefix) *Limiter {
+	return &Limiter{store: store, db: db, routes: routes, fallback: fallback, client: client, proxies: proxies, now: time.Now}
+}
+
+// ParseTrustedProxies reads addresses and ranges such as "10.0.0.0/8".
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, item := range list {
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: want an address or a CIDR range", item)
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+func (l *Limiter) policyFor(r *http.Request) (route string, policy *Policy) {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return "", l.fallback
+	}
+	template, err := current.GetPathTemplate()
+	if err != nil {
+		return "", l.fallback
+	}
+	route = r.Method + " " + template
+	if policy, ok := l.routes[route]; ok {
+		return route, &policy
+	}
+	return route, l.fallback
+}
+
+// maxPeekSize bounds how much of a creation body is read to find its author.
+const maxPeekSize = 1 << 20
+
+// userFromRequest finds who is acting: the username parameters of the query,
+// or the author of a tender or bid being created.
+func userFromRequest(db *sql.DB, r *http.Request) string {
+	query := r.URL.Query()
+	for _, name := range []string{"username", "requesterUsername"} {
+		if user_name := query.Get(name); user_name != "" {
+			return user_name
+		}
+	}
+	if r.Method != http.MethodPost || r.Body == nil {
+		return ""
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxPeekSize))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+	if err != nil {
+		return ""
+	}
+	var body struct {
+		CreatorUsername string `json:"creatorUsername"`
+		AuthorType      string `json:"authorType"`
+		AuthorId        int    `json:"authorId"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		return ""
+	}
+	if body.CreatorUsername != "" {
+		return body.CreatorUsername
+	}
+	if body.AuthorId != 0 && body.AuthorType != "Organization" {
+		user_name, err_info := dbhelp.GetUserName(r.Context(), db, body.AuthorId)
+		if err_info.Status == 200 {
+			return user_name
+		}
+	}
+	return ""
+}
+
+func (l *Limiter) trusted(addr netip.Addr) bool {
+	for _, prefix := range l.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the remote address or, behind trusted proxies, the last
+// X-Forwarded-For hop not added by one of them.
+func (l *Limiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !l.trusted(addr.Unmap()) {
+		return host
+	}
+	addr = addr.Unmap()
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !l.trusted(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// bucketKey falls back to the client IP when the user or organization is
+// unknown. It may query the database.
+func (l *Limiter) bucketKey(r *http.Request, policy *Policy, client_ip string) string {
+	switch policy.Key {
+	case KeyUser:
+		if user_name := userFromRequest(l.db, r); user_name != "" {
+			return "user:" + user_name
+		}
+	case KeyOrganization:
+		if user_name := userFromRequest(l.db, r); user_name != "" {
+			organization_id, err_info := dbhelp.GetUserOrganizationId(r.Context(), l.db, user_name)
+			if err_info.Status == 200 {
+				return "organization:" + strconv.Itoa(organization_id)
+			}
+		}
+	}
+	return "ip:" + client_ip
+}
+
+// take removes a token from the bucket; ok is false when the store failed.
+func (l *Limiter) take(r *http.Request, key string, policy *Policy) (result Result, ok bool) {
+	result, err := l.store.Take(r.Context(), key, policy.Rate, policy.Burst, l.now())
+	if err != nil {
+		logging.FromRequest(r).Error("rate limit store failed", "err", err)
+		return result, false
+	}
+	return result, true
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// writeResult sets the RateLimit headers and answers 429 with Retry-After
+// when the bucket is empty.
+func writeResult(w http.ResponseWriter, policy *Policy, result Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", ceilSeconds(result.ResetAfter))
+	if !result.Allowed {
+		w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+		errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeRateLimited))
+	}
+}
+
+// Middleware answers 429 with Retry-After when the bucket is empty and sets
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers on
+// every limited route. When the store fails requests are let through.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, policy := l.policyFor(r)
+		if policy == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client_ip := l.clientIP(r)
+		// The usernames are not verified and finding the user may query the
+		// database, so the client IP is limited first.
+		if policy.Key != KeyIP && l.client != nil {
+			if result, ok := l.take(r, route+"|client:"+client_ip, l.client); ok && !result.Allowed {
+				writeResult(w, l.client, result)
+				return
+			}
+		}
+		result, ok := l.take(r, route+"|"+l.bucketKey(r, policy, client_ip), policy)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writeResult(w, policy, result)
+		if result.Allowed {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("user:20/1m:5")
+	if err != nil || policy.Key != KeyUser || policy.Burst != 5 || policy.Rate != 20.0/60 {
+		t.Errorf("got %+v, %v", policy, err)
+	}
+	policy, err = ParsePolicy("ip:10/s")
+	if err != nil || policy.Burst != 10 || policy.Rate != 10 {
+		t.Errorf("got %+v, %v", policy, err)
+	}
+	for _, s := range []string{"user", "robot:1/s", "user:0/s", "user:1/", "user:1/s:0", "user:1/s:2:3"} {
+		if _, err := ParsePolicy(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("POST  /api/bids/new=off; GET /api/tenders/my=ip:5/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := routes["POST /api/bids/new"]; ok {
+		t.Error("bids/new limit not removed")
+	}
+	if routes["GET /api/tenders/my"].Key != KeyIP {
+		t.Errorf("routes = %v", routes)
+	}
+	if _, ok := routes["POST /api/tenders/new"]; !ok {
+		t.Error("default route lost")
+	}
+	if _, err := ParseRoutes("/api/bids/new=user:1/s"); err == nil {
+		t.Error("route without method accepted")
+	}
+}
+
+// checkStore takes a bucket of 2 refilling at 1 token per second.
+func checkStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	want := []struct {
+		after   time.Duration
+		allowed bool
+		retry   time.Duration
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, time.Second},
+		{500 * time.Millisecond, false, 500 * time.Millisecond},
+		{time.Second, true, 0},
+	}
+	for i, w := range want {
+		now = now.Add(w.after)
+		result, err := store.Take(ctx, "k", 1, 2, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != w.allowed || result.RetryAfter != w.retry {
+			t.Errorf("take %d: %+v, want allowed %v retry %v", i, result, w.allowed, w.retry)
+		}
+	}
+	other, _ := store.Take(ctx, "other", 1, 2, now)
+	if !other.Allowed || other.Remaining != 1 {
+		t.Errorf("other bucket: %+v", other)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	checkStore(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	checkStore(t, NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()})))
+	if ttl := server.TTL("ratelimit:k"); ttl <= 0 || ttl > 2*time.Second {
+		t.Errorf("bucket ttl %v", ttl)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), nil, map[string]Policy{
+		"PUT /api/bids/{bidId}/submit_decision": {Key: KeyUser, Rate: 1.0 / 60, Burst: 1},
+	}, nil, &Policy{Key: KeyIP, Rate: 1.0 / 60, Burst: 3}, nil)
+	r := mux.NewRouter()
+	r.Use(limiter.Middleware)
+	r.HandleFunc("/api/bids/{bidId}/submit_decision", func(w http.ResponseWriter, r *http.Request) {}).Methods("PUT")
+	r.HandleFunc("/api/ping", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+
+	send := func(method, path, ip string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	first := send("PUT", "/api/bids/1/submit_decision?username=user1", "192.0.2.1")
+	if first.Code != http.StatusOK || first.Header().Get("RateLimit-Remaining") != "0" || first.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("first: %d %v", first.Code, first.Header())
+	}
+	second := send("PUT", "/api/bids/2/submit_decision?username=user1", "192.0.2.2")
+	if second.Code != http.StatusTooManyRequests || second.Header().Get("Retry-After") != "60" {
+		t.Errorf("same user from another IP: %d %v", second.Code, second.Header())
+	}
+	if other := send("PUT", "/api/bids/1/submit_decision?username=user2", "192.0.2.1"); other.Code != http.StatusOK {
+		t.Errorf("other user from the same IP: %d", other.Code)
+	}
+	third := send("PUT", "/api/bids/1/submit_decision?username=user3", "192.0.2.1")
+	if third.Code != http.StatusOK {
+		t.Errorf("third user from the same IP: %d", third.Code)
+	}
+	client := send("PUT", "/api/bids/1/submit_decision?username=user4", "192.0.2.1")
+	if client.Code != http.StatusTooManyRequests || client.Header().Get("RateLimit-Limit") != "3" {
+		t.Errorf("client IP over its limit: %d %v", client.Code, client.Header())
+	}
+	if ping := send("GET", "/api/ping", "192.0.2.1"); ping.Code != http.StatusOK || ping.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("unlimited route: %d %v", ping.Code, ping.Header())
+	}
+}
+
+// The author of a bid is looked up in the database, which must not happen
+// once the client IP is limited; the limiter has no database here.
+func TestMiddlewareLimitsClientFirst(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), nil, map[string]Policy{
+		"POST /api/bids/new": {Key: KeyUser, Rate: 1.0 / 60, Burst: 5},
+	}, nil, &Policy{Key: KeyIP, Rate: 1.0 / 60, Burst: 1}, nil)
+	r := mux.NewRouter()
+	r.Use(limiter.Middleware)
+	r.HandleFunc("/api/bids/new", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+
+	send := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/api/bids/new", strings.NewReader(body)))
+		return rec
+	}
+	if first := send(`{"authorType":"Organization","authorId":1}`); first.Code != http.StatusOK {
+		t.Fatalf("first: %d", first.Code)
+	}
+	if second := send(`{"authorType":"User","authorId":7}`); second.Code != http.StatusTooManyRequests {
+		t.Errorf("second: %d", second.Code)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "::ffff:198.51.100.7", "2001:db8::/32"})
+	if err != nil || len(proxies) != 4 || proxies[2].String() != "198.51.100.7/32" {
+		t.Errorf("got %v, %v", proxies, err)
+	}
+	if _, err := ParseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("host name accepted")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	limiter := NewLimiter(NewMemoryStore(), nil, nil, nil, nil, proxies)
+	cases := []struct {
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"10.0.0.1:1234", []string{"203.0.113.9, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"10.0.0.1:1234", []string{"203.0.113.9", "198.51.100.7"}, "198.51.100.7"},
+		{"10.0.0.1:1234", []string{"garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"[::ffff:10.0.0.1]:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/ping", nil)
+		r.RemoteAddr = c.remote
+		for _, value := range c.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := limiter.clientIP(r); got != c.want {
+			t.Errorf("%s %v: got %s, want %s", c.remote, c.forwarded, got, c.want)
+		}
+	}
+}
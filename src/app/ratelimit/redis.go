@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a bucket kept in a hash, atomically.
+// Tokens are returned as a string since Redis truncates Lua numbers.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) / 1000 * rate)
+	last = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(last))
+redis.call('PEXPIRE', KEYS[1], math.max(1, math.ceil((burst - tokens) / rate * 1000)))
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore shares buckets between replicas through any server speaking
+// the Redis protocol with Lua scripting.
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+func NewRedisStore(client redis.Scripter) *RedisStore {
+	return &RedisStore{client: client, prefix: "ratelimit:"}
+}
+
+// NewRedisStoreFromURL connects to e.g. redis://localhost:6379/0.
+func NewRedisStoreFromURL(url string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisStore(redis.NewClient(options)), nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (Result, error) {
+	values, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		rate, burst, now.UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed, _ := values[0].(int64)
+	s_tokens, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(s_tokens, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(allowed == 1, tokens, rate, burst), nil
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result is the state of a bucket after one Take.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until one token is available, zero if allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Store keeps token buckets. Take removes one token from the bucket key that
+// refills at rate tokens per second up to burst tokens.
+type Store interface {
+	Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket refills completely and can be forgotten.
+	full time.Time
+}
+
+// take is the token bucket; the Redis script implements the same steps.
+func (b *bucket) take(rate float64, burst int, now time.Time) Result {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		b.last = now
+	}
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newResult(allowed, b.tokens, rate, burst)
+}
+
+// newResult describes a bucket left with tokens after a Take.
+func newResult(allowed bool, tokens, rate float64, burst int) Result {
+	result := Result{
+		Allowed:    allowed,
+		Remaining:  int(tokens),
+		ResetAfter: secondsToDuration((float64(burst) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+// MemoryStore keeps buckets in the process; every replica limits on its own.
+type MemoryStore struct {
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+const cleanupInterval = time.Minute
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastCleanup) > cleanupInterval {
+		s.cleanup(now)
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	result := b.take(rate, burst, now)
+	b.full = now.Add(result.ResetAfter)
+	return result, nil
+}
+
+// cleanup forgets full buckets, they are the same as missing ones.
+func (s *MemoryStore) cleanup(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastCleanup = now
+}
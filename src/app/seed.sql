@@ -0,0 +1,36 @@
+-- Demo employees and organizations of init.sql. Rows that already exist are
+-- kept, so seeding twice changes nothing.
+
+INSERT INTO employee (username, first_name, last_name) VALUES
+    ('user1', 'John', 'Doe'),
+    ('user2', 'Jane', 'Smith'),
+    ('user3', 'Alice', 'Johnson'),
+    ('user4', 'Bob', 'Brown'),
+    ('user5', 'Charlie', 'Davis'),
+    ('user6', 'Charlie', 'Davis')
+ON CONFLICT (username) DO NOTHING;
+
+INSERT INTO organization (name, description, type)
+SELECT v.name, v.description, v.type::organization_type
+FROM (VALUES
+    ('Organization A', 'This is organization A', 'LLC'),
+    ('Organization B', 'This is organization B', 'IE'),
+    ('Organization C', 'This is organization C', 'JSC')
+) AS v(name, description, type)
+WHERE NOT EXISTS (SELECT 1 FROM organization o WHERE o.name = v.name);
+
+INSERT INTO organization_responsible (organization_id, user_id)
+SELECT o.id, e.id
+FROM (VALUES
+    ('Organization A', 'user1'),
+    ('Organization A', 'user2'),
+    ('Organization B', 'user3'),
+    ('Organization C', 'user4'),
+    ('Organization C', 'user5'),
+    ('Organization A', 'user6')
+) AS v(organization, username)
+JOIN organization o ON o.name = v.organization
+JOIN employee e ON e.username = v.username
+WHERE NOT EXISTS (
+    SELECT 1 FROM organization_responsible r WHERE r.organization_id = o.id AND r.user_id = e.id
+);
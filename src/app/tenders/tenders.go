@@ -1,11 +1,13 @@
 package tenders
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
 	"time"
 
+	"go_server/m/cache"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
@@ -13,43 +15,64 @@ import (
 	"github.com/google/uuid"
 )
 
+// Visibility decides who sees a tender besides its organizations.
+const (
+	VisibilityPublic     = "public"
+	VisibilityInviteOnly = "invite_only"
+	VisibilityInternal   = "internal"
+)
+
 type Tender struct {
-	ID             uuid.UUID `json:"id"`
-	Name           string    `json:"name" binding:"required"`
-	Description    string    `json:"description" binding:"required"`
-	Status         string    `json:"status" binding:"required"`
-	ServiceType    string    `json:"service_type"`
-	AuthorID       int       `json:"-"`
-	OrganizationID int       `json:"-"`
-	Version        int       `json:"version" gorm:"default:1"`
-	CreatedAt      time.Time `json:"created_at" gorm:"default:current_timestamp"`
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name" binding:"required"`
+	Description string    `json:"description" binding:"required"`
+	Status      string    `json:"status" binding:"required"`
+	ServiceType string    `json:"service_type"`
+	Visibility  string    `json:"visibility"`
+	// RequiresQualification only admits bids of suppliers qualified for
+	// the service type, see package qualifications.
+	RequiresQualification bool      `json:"requires_qualification"`
+	AuthorID              int       `json:"-"`
+	OrganizationID        int       `json:"-"`
+	Version               int       `json:"version" gorm:"default:1"`
+	CreatedAt             time.Time `json:"created_at" gorm:"default:current_timestamp"`
 }
 
 func createTenderDataToTender(req CreateTenderData, user_id, version int, created_at time.Time) *Tender {
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
 	return &Tender{
-		Name:        req.Name,
-		Description: req.Description,
-		Status:      req.Status,
-		ServiceType: req.ServiceType,
-		AuthorID:    user_id,
-		Version:     version,
-		CreatedAt:   created_at,
+		Name:                  req.Name,
+		Description:           req.Description,
+		Status:                req.Status,
+		ServiceType:           req.ServiceType,
+		Visibility:            visibility,
+		RequiresQualification: req.RequiresQualification,
+		AuthorID:              user_id,
+		Version:               version,
+		CreatedAt:             created_at,
 	}
 }
 
 type CreateTenderData struct {
-	Name            string `json:"name"`
-	Description     string `json:"description"`
-	ServiceType     string `json:"serviceType"`
-	Status          string `json:"status"`
-	OrganizationID  int    `json:"organizationId"`
-	CreatorUsername string `json:"creatorUsername"`
+	Name                  string `json:"name"`
+	Description           string `json:"description"`
+	ServiceType           string `json:"serviceType"`
+	Status                string `json:"status"`
+	Visibility            string `json:"visibility"`
+	RequiresQualification bool   `json:"requiresQualification"`
+	OrganizationID        int    `json:"organizationId"`
+	CreatorUsername       string `json:"creatorUsername"`
 }
 
 type editTenderRequestBody struct {
-	Name        string `json:"name,omitempty"`
-	Description string `json:"description,omitempty"`
-	ServiceType string `json:"serviceType,omitempty"`
+	Name                  string `json:"name,omitempty"`
+	Description           string `json:"description,omitempty"`
+	ServiceType           string `json:"serviceType,omitempty"`
+	Visibility            string `json:"visibility,omitempty"`
+	RequiresQualification *bool  `json:"requiresQualification,omitempty"`
 }
 
 // func getIntFromRequest(r *http.Request, default_val int, param_name string) (num int, err_info errinfo.ErrorInfo) {
@@ -79,58 +102,52 @@ type editTenderRequestBody struct {
 // 	return
 // }
 
-func GetTenders(db *sql.DB, limit, offset int, service_type string) ([]Tender, errinfo.ErrorInfo) {
-	var query string
-	var args []interface{}
-	var err_info errinfo.ErrorInfo
-	if service_type != "" {
-		query = `
-		SELECT id, name, description, status, service_type, author_id, version, created_at 
-		FROM tenders
-		WHERE service_type = $1
-		ORDER BY name
-		LIMIT $2
-		OFFSET $3
-		`
-		args = []interface{}{service_type, limit, offset}
-	} else {
-		query = `
-		SELECT id, name, description, status, service_type, author_id, version, created_at 
-		FROM tenders
-		ORDER BY name
-		LIMIT $1
-		OFFSET $2
-		`
-		args = []interface{}{limit, offset}
-	}
-
-	rows, err := db.Query(query, args...)
-	err_info.Status = dbhelp.SqlErrToStatus(err, 500)
+// GetTenders lists the tenders the user sees: every tender of the user's
+// own and co-owner organizations, and of the others the published public
+// ones and the published invite-only ones of invited organizations.
+// Without a user (user_id 0) only the published public ones.
+func GetTenders(ctx context.Context, db *sql.DB, user_id, limit, offset int, service_type string) ([]Tender, errinfo.ErrorInfo) {
+	query := `
+	SELECT t.id, t.name, t.description, t.status, t.service_type, t.visibility, t.requires_qualification, t.author_id, t.organization_id, t.version, t.created_at
+	FROM tenders t
+	WHERE ($1 = '' OR t.service_type = $1)
+	  AND (EXISTS (
+	           SELECT 1 FROM organization_responsible orgr
+	           WHERE orgr.user_id = $2 AND (orgr.organization_id = t.organization_id
+	               OR orgr.organization_id IN (SELECT o.organization_id FROM tender_owners o WHERE o.tender_id = t.id))
+	       )
+	       OR (t.status = 'Published' AND (t.visibility = 'public'
+	           OR (t.visibility = 'invite_only' AND EXISTS (
+	               SELECT 1 FROM tender_invitations i
+	               JOIN organization_responsible orgr ON orgr.organization_id = i.organization_id
+	               WHERE i.tender_id = t.id AND orgr.user_id = $2)))))
+	ORDER BY t.name
+	LIMIT $3
+	OFFSET $4
+	`
+	rows, err := db.QueryContext(ctx, query, service_type, user_id, limit, offset)
+	err_info := dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 	if err_info.Status != 200 {
-		err_info.Reason = errinfo.ErrMessageServer
 		return nil, err_info
 	}
 	defer rows.Close()
 	var tenders []Tender
 	for rows.Next() {
 		var tender Tender
-		if err := rows.Scan(&tender.ID, &tender.Name, &tender.Description, &tender.Status, &tender.ServiceType, &tender.AuthorID, &tender.Version, &tender.CreatedAt); err != nil {
-			err_info.Reason = errinfo.ErrMessageServer
-			err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-			return nil, err_info
+		if err := rows.Scan(&tender.ID, &tender.Name, &tender.Description, &tender.Status, &tender.ServiceType, &tender.Visibility,
+			&tender.RequiresQualification, &tender.AuthorID, &tender.OrganizationID, &tender.Version, &tender.CreatedAt); err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		}
 		tenders = append(tenders, tender)
 	}
 	if err := rows.Err(); err != nil {
-		err_info.Reason = errinfo.ErrMessageServer
-		err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-		return nil, err_info
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 	}
 
 	return tenders, err_info
 }
 
-func getArchivedTenders(db *sql.DB, limit, offset int, service_type string) ([]Tender, error) {
+func getArchivedTenders(ctx context.Context, db *sql.DB, limit, offset int, service_type string) ([]Tender, error) {
 	var query string
 	var args []interface{}
 	if service_type != "" {
@@ -154,7 +171,7 @@ func getArchivedTenders(db *sql.DB, limit, offset int, service_type string) ([]T
 		args = []interface{}{limit, offset}
 	}
 
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -177,23 +194,23 @@ func getArchivedTenders(db *sql.DB, limit, offset int, service_type string) ([]T
 func TendersArchiveHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
 		if r.Method != http.MethodGet {
-			err_info.Reason = errinfo.ErrMessageMethodNotAllowed
-			err_info.Status = 405
-			errinfo.SendHttpErr(w, err_info)
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeMethodNotAllowed))
 			return
 		}
 		service_type := r.URL.Query().Get("service_type")
 		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
-		if err_info.Status != 200 || !helpers.IsOkServiceType(service_type) {
+		if err_info.Status == 200 && !helpers.IsOkServiceType(service_type) {
+			err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("service_type", "Unknown service type.")
+		}
+		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
 
-		tenders, err := getArchivedTenders(db, limit, offset, service_type)
+		tenders, err := getArchivedTenders(r.Context(), db, limit, offset, service_type)
 		if err != nil {
-			errinfo.SendHttpErr(w, err_info)
+			errinfo.SendHttpErr(w, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer))
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -201,17 +218,25 @@ func TendersArchiveHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// TendersHandler lists the tenders visible to the optional username.
 func TendersHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
 		service_type := r.URL.Query().Get("service_type")
+		user_name := r.URL.Query().Get("username")
 		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
-		if err_info.Status != 200 || !helpers.IsOkServiceType(service_type) {
+		if err_info.Status == 200 && !helpers.IsOkServiceType(service_type) {
+			err_info = errinfo.New(errinfo.CodeValidationFailed).WithField("service_type", "Unknown service type.")
+		}
+		var user_id int
+		if err_info.Status == 200 && user_name != "" {
+			user_id, err_info = dbhelp.GetUserId(r.Context(), db, user_name)
+		}
+		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
 
-		tenders, err_info := GetTenders(db, limit, offset, service_type)
+		tenders, err_info := GetTenders(r.Context(), db, user_id, limit, offset, service_type)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
@@ -221,19 +246,44 @@ func TendersHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func GetTender(db *sql.DB, tender_id uuid.UUID) (*Tender, errinfo.ErrorInfo) {
-	var err_info errinfo.ErrorInfo
-	err_info.Status = 200
+func tenderKey(tender_id uuid.UUID) string {
+	return "tender:" + tender_id.String()
+}
+
+// rememberTender caches the tender for the request and the other ones;
+// generation is cache.Generation taken before it was read.
+func rememberTender(ctx context.Context, tender Tender, generation uint64) {
+	dbhelp.CachePut(ctx, tenderKey(tender.ID), tender)
+	cache.Put(ctx, tenderKey(tender.ID), generation, tender)
+}
+
+// invalidateTender is called once a change of the tenders row is committed.
+func invalidateTender(ctx context.Context, tender_id uuid.UUID) {
+	dbhelp.CacheForget(ctx, tenderKey(tender_id))
+	cache.Invalidate(ctx, tenderKey(tender_id))
+}
+
+// GetTender returns a copy of the tender, which callers may change.
+func GetTender(ctx context.Context, db *sql.DB, tender_id uuid.UUID) (*Tender, errinfo.ErrorInfo) {
+	if tender, ok := dbhelp.CacheGet[Tender](ctx, tenderKey(tender_id)); ok {
+		return &tender, errinfo.Ok()
+	}
+	if tender, ok := cache.Get[Tender](ctx, tenderKey(tender_id)); ok {
+		dbhelp.CachePut(ctx, tenderKey(tender_id), tender)
+		return &tender, errinfo.Ok()
+	}
+	err_info := errinfo.Ok()
+	generation := cache.Generation(tenderKey(tender_id))
 
 	query := `
-    SELECT t.id, t.name, t.description, t.status, t.service_type, 
-           t.author_id, t.organization_id, t.version, t.created_at
+    SELECT t.id, t.name, t.description, t.status, t.service_type, t.visibility,
+           t.requires_qualification, t.author_id, t.organization_id, t.version, t.created_at
     FROM tenders t
     WHERE t.id = $1
     `
-	rows, err := db.Query(query, tender_id)
+	rows, err := db.QueryContext(ctx, query, tender_id)
 	if err != nil {
-		err_info = dbhelp.SqlErrToErrInfo(err, 500, errinfo.ErrMessageServer)
+		err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		return nil, err_info
 	}
 	defer rows.Close()
@@ -241,14 +291,15 @@ func GetTender(db *sql.DB, tender_id uuid.UUID) (*Tender, errinfo.ErrorInfo) {
 	var tender Tender
 	if rows.Next() {
 		if err := rows.Scan(&tender.ID, &tender.Name, &tender.Description,
-			&tender.Status, &tender.ServiceType, &tender.AuthorID,
+			&tender.Status, &tender.ServiceType, &tender.Visibility, &tender.RequiresQualification, &tender.AuthorID,
 			&tender.OrganizationID, &tender.Version, &tender.CreatedAt); err != nil {
-			err_info = dbhelp.SqlErrToErrInfo(err, 500, errinfo.ErrMessageServer)
+			err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 			return nil, err_info
 		}
+		rememberTender(ctx, tender, generation)
 		return &tender, err_info
 	}
-	err_info = dbhelp.SqlErrToErrInfo(sql.ErrNoRows, 404, errinfo.ErrMessageTenderNotFound)
+	err_info = errinfo.New(errinfo.CodeTenderNotFound)
 
 	return nil, err_info
 }
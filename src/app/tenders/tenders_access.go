@@ -0,0 +1,267 @@
+package tenders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"go_server/m/cache"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Access is what the permission checks need to know about a caller and a
+// tender. UserID is 0 and Tender is nil when they do not exist.
+type Access struct {
+	UserID   int
+	UserName string
+	Tender   *Tender
+	// Responsible is set when the caller is responsible for the tender
+	// organization or for one of its co-owners.
+	Responsible bool
+	// Rights are those of the caller's organizations; the tender
+	// organization has them all.
+	Rights []Right
+	// Invited is set when the caller is responsible for an organization
+	// invited to the tender. It only matters while the tender is
+	// invite-only.
+	Invited bool
+}
+
+// Visible tells whether the caller sees the tender: everyone a public one,
+// the invited organizations an invite-only one, and only the tender
+// organizations an internal one.
+func (a *Access) Visible() bool {
+	switch a.Tender.Visibility {
+	case VisibilityInviteOnly:
+		return a.Responsible || a.Invited
+	case VisibilityInternal:
+		return a.Responsible
+	}
+	return true
+}
+
+// VisibleErr reports a tender hidden from the caller as missing, so its
+// existence is not disclosed.
+func (a *Access) VisibleErr() errinfo.ErrorInfo {
+	if a.Tender == nil || !a.Visible() {
+		return errinfo.New(errinfo.CodeTenderNotFound)
+	}
+	return errinfo.Ok()
+}
+
+// Err reports the first failed check: the caller, the tender, then whether
+// the caller is responsible for the tender organization.
+func (a *Access) Err() errinfo.ErrorInfo {
+	switch {
+	case a.UserID == 0:
+		return errinfo.New(errinfo.CodeWrongUser)
+	case a.Tender == nil:
+		return errinfo.New(errinfo.CodeTenderNotFound)
+	case !a.Responsible:
+		return errinfo.New(errinfo.CodeNoPermission)
+	}
+	return errinfo.Ok()
+}
+
+// TenderErr is Err checking the tender before the caller, for the routes
+// addressed by the tender.
+func (a *Access) TenderErr() errinfo.ErrorInfo {
+	if a.Tender == nil {
+		return errinfo.New(errinfo.CodeTenderNotFound)
+	}
+	return a.Err()
+}
+
+// Allow is Err also requiring the caller to have right.
+func (a *Access) Allow(right Right) errinfo.ErrorInfo {
+	err_info := a.Err()
+	if err_info.Status == 200 && !slices.Contains(a.Rights, right) {
+		err_info = errinfo.New(errinfo.CodeNoPermission)
+	}
+	return err_info
+}
+
+// TenderAllow is Allow checking the tender before the caller.
+func (a *Access) TenderAllow(right Right) errinfo.ErrorInfo {
+	if a.Tender == nil {
+		return errinfo.New(errinfo.CodeTenderNotFound)
+	}
+	return a.Allow(right)
+}
+
+// grant adds the rights of an organization the caller is responsible for.
+func (a *Access) grant(rights []Right) {
+	a.Responsible = true
+	for _, right := range rights {
+		if !slices.Contains(a.Rights, right) {
+			a.Rights = append(a.Rights, right)
+		}
+	}
+}
+
+// accessQuery loads the caller, the tender, the membership in the tender
+// organization, the rights through co-owners and the invitations in one
+// round trip; %s selects the caller by username or by id.
+const accessQuery = `
+	SELECT e.id, e.username,
+	       t.id, t.name, t.description, t.status, t.service_type, t.visibility,
+	       t.requires_qualification, t.author_id, t.organization_id, t.version, t.created_at,
+	       EXISTS (
+	           SELECT 1 FROM organization_responsible orgr
+	           WHERE orgr.user_id = e.id AND orgr.organization_id = t.organization_id
+	       ),
+	       co.member, co.rights,
+	       EXISTS (
+	           SELECT 1 FROM tender_invitations i
+	           JOIN organization_responsible orgr ON orgr.organization_id = i.organization_id
+	           WHERE i.tender_id = t.id AND orgr.user_id = e.id
+	       )
+	FROM (SELECT 1) AS one
+	LEFT JOIN employee e ON %s = $1
+	LEFT JOIN tenders t ON t.id = $2
+	LEFT JOIN LATERAL (
+	    SELECT COUNT(*) > 0 AS member,
+	           array_agg(DISTINCT r.right_name) FILTER (WHERE r.right_name IS NOT NULL) AS rights
+	    FROM tender_owners o
+	    JOIN organization_responsible orgr ON orgr.organization_id = o.organization_id AND orgr.user_id = e.id
+	    LEFT JOIN LATERAL unnest(o.rights) AS r(right_name) ON true
+	    WHERE o.tender_id = t.id
+	) co ON true
+	LIMIT 1
+	`
+
+// GetAccess resolves the user named user_name and the tender. With the
+// shared cache on, the user, the tender, the organizations of the user, the
+// co-owners and the invitations are read through it, so a repeated check
+// needs no query. Without it they are loaded in one round trip. Either way
+// the results are kept in the request cache, so later GetTender and
+// dbhelp.GetUserId calls of the request do not query again.
+func GetAccess(ctx context.Context, db *sql.DB, user_name string, tender_id uuid.UUID) (*Access, errinfo.ErrorInfo) {
+	if !cache.Enabled() {
+		if user_id, ok := dbhelp.CachedUserId(ctx, user_name); ok {
+			return loadAccess(ctx, db, "e.id", user_id, tender_id)
+		}
+		return loadAccess(ctx, db, "e.username", user_name, tender_id)
+	}
+	user_id, err_info := dbhelp.GetUserId(ctx, db, user_name)
+	if err_info.Code == errinfo.CodeWrongUser {
+		user_id, err_info = 0, errinfo.Ok()
+	}
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	return cachedAccess(ctx, db, user_id, user_name, tender_id)
+}
+
+// GetAccessByUserId is GetAccess for a caller known by id, such as the
+// author of a new bid.
+func GetAccessByUserId(ctx context.Context, db *sql.DB, user_id int, tender_id uuid.UUID) (*Access, errinfo.ErrorInfo) {
+	if !cache.Enabled() {
+		return loadAccess(ctx, db, "e.id", user_id, tender_id)
+	}
+	user_name, err_info := dbhelp.GetUserName(ctx, db, user_id)
+	if err_info.Code == errinfo.CodeWrongUser {
+		user_id, err_info = 0, errinfo.Ok()
+	}
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	return cachedAccess(ctx, db, user_id, user_name, tender_id)
+}
+
+// cachedAccess puts the access together from lookups the shared cache
+// answers; user_id is 0 for an unknown caller.
+func cachedAccess(ctx context.Context, db *sql.DB, user_id int, user_name string, tender_id uuid.UUID) (*Access, errinfo.ErrorInfo) {
+	access := &Access{}
+	if user_id != 0 {
+		access.UserID, access.UserName = user_id, user_name
+	}
+	tender, err_info := GetTender(ctx, db, tender_id)
+	if err_info.Code == errinfo.CodeTenderNotFound {
+		return access, errinfo.Ok()
+	}
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	access.Tender = tender
+	if user_id == 0 {
+		return access, errinfo.Ok()
+	}
+	organization_ids, err_info := dbhelp.GetUserOrganizations(ctx, db, user_id)
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	if slices.Contains(organization_ids, tender.OrganizationID) {
+		access.grant(AllRights)
+		return access, errinfo.Ok()
+	}
+	owners, err_info := GetOwners(ctx, db, tender.ID)
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	for _, owner := range owners {
+		if slices.Contains(organization_ids, owner.OrganizationID) {
+			access.grant(owner.Rights)
+		}
+	}
+	if tender.Visibility != VisibilityInviteOnly || access.Responsible {
+		return access, errinfo.Ok()
+	}
+	invitations, err_info := GetInvitations(ctx, db, tender.ID)
+	if err_info.Status != 200 {
+		return nil, err_info
+	}
+	for _, invitation := range invitations {
+		if slices.Contains(organization_ids, invitation.OrganizationID) {
+			access.Invited = true
+		}
+	}
+	return access, errinfo.Ok()
+}
+
+// loadAccess runs accessQuery when there is no shared cache.
+func loadAccess(ctx context.Context, db *sql.DB, user_column string, user interface{}, tender_id uuid.UUID) (*Access, errinfo.ErrorInfo) {
+	var user_id sql.NullInt64
+	var user_name sql.NullString
+	var id uuid.NullUUID
+	var tender Tender
+	var name, description, status, service_type, visibility sql.NullString
+	var author_id, organization_id, version sql.NullInt64
+	var created_at sql.NullTime
+	var responsible, invited bool
+	var requires_qualification sql.NullBool
+	var co_owner sql.NullBool
+	var co_rights pq.StringArray
+	access := &Access{}
+	generation := cache.Generation(tenderKey(tender_id))
+	err := db.QueryRowContext(ctx, fmt.Sprintf(accessQuery, user_column), user, tender_id).Scan(
+		&user_id, &user_name, &id, &name, &description, &status, &service_type, &visibility,
+		&requires_qualification, &author_id, &organization_id, &version, &created_at, &responsible, &co_owner, &co_rights, &invited)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	if responsible {
+		access.grant(AllRights)
+	} else if co_owner.Bool {
+		access.grant(toRights(co_rights))
+	}
+	access.Invited = invited
+	if user_id.Valid {
+		access.UserID, access.UserName = int(user_id.Int64), user_name.String
+		dbhelp.RememberUser(ctx, access.UserID, access.UserName)
+	}
+	if id.Valid {
+		tender = Tender{ID: id.UUID, Name: name.String, Description: description.String, Status: status.String,
+			ServiceType: service_type.String, Visibility: visibility.String,
+			RequiresQualification: requires_qualification.Bool, AuthorID: int(author_id.Int64), OrganizationID: int(organization_id.Int64),
+			Version: int(version.Int64), CreatedAt: created_at.Time}
+		rememberTender(ctx, tender, generation)
+		access.Tender = &tender
+	}
+	return access, errinfo.Ok()
+}
@@ -0,0 +1,181 @@
+package tenders
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go_server/m/cache"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+
+	"github.com/google/uuid"
+)
+
+func TestAccessRights(t *testing.T) {
+	tender := &Tender{OrganizationID: 1}
+	co_owner := &Access{UserID: 3, Tender: tender}
+	co_owner.grant([]Right{RightStatus})
+	co_owner.grant([]Right{RightBids, RightStatus})
+	if len(co_owner.Rights) != 2 {
+		t.Errorf("rights = %v", co_owner.Rights)
+	}
+	if err_info := co_owner.Err(); err_info.Status != 200 {
+		t.Errorf("co-owner can't view: %v", err_info.Code)
+	}
+	if err_info := co_owner.Allow(RightBids); err_info.Status != 200 {
+		t.Errorf("co-owner can't decide: %v", err_info.Code)
+	}
+	for _, right := range []Right{RightEdit, RightOwners} {
+		if err_info := co_owner.Allow(right); err_info.Code != errinfo.CodeNoPermission {
+			t.Errorf("co-owner allowed %s: %v", right, err_info.Code)
+		}
+	}
+
+	stranger := &Access{UserID: 4, Tender: tender}
+	if err_info := stranger.Allow(RightEdit); err_info.Code != errinfo.CodeNoPermission {
+		t.Errorf("stranger allowed to edit: %v", err_info.Code)
+	}
+	missing := &Access{UserID: 4}
+	if err_info := missing.TenderAllow(RightEdit); err_info.Code != errinfo.CodeTenderNotFound {
+		t.Errorf("missing tender: %v", err_info.Code)
+	}
+}
+
+func TestAccessVisible(t *testing.T) {
+	cases := []struct {
+		visibility string
+		access     Access
+		want       bool
+	}{
+		{VisibilityPublic, Access{}, true},
+		{VisibilityInviteOnly, Access{UserID: 3}, false},
+		{VisibilityInviteOnly, Access{UserID: 3, Invited: true}, true},
+		{VisibilityInviteOnly, Access{UserID: 1, Responsible: true}, true},
+		{VisibilityInternal, Access{UserID: 3, Invited: true}, false},
+		{VisibilityInternal, Access{UserID: 1, Responsible: true}, true},
+	}
+	for _, c := range cases {
+		access := c.access
+		access.Tender = &Tender{OrganizationID: 1, Visibility: c.visibility}
+		if got := access.Visible(); got != c.want {
+			t.Errorf("%s %+v: visible = %v", c.visibility, c.access, got)
+		}
+		if err_info := access.VisibleErr(); (err_info.Status == 200) != c.want {
+			t.Errorf("%s %+v: %v", c.visibility, c.access, err_info.Code)
+		}
+	}
+}
+
+// fakeDB answers every query from the rows of the first table the query
+// names and counts the queries.
+type fakeDB struct {
+	mu      sync.Mutex
+	queries int
+	tables  []fakeTable
+}
+
+type fakeTable struct {
+	name    string
+	columns int
+	rows    [][]driver.Value
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return f, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return f }
+func (f *fakeDB) Open(string) (driver.Conn, error)             { return f, nil }
+func (f *fakeDB) Close() error                                 { return nil }
+func (f *fakeDB) Begin() (driver.Tx, error)                    { return nil, errors.New("fakeDB: no transactions") }
+func (f *fakeDB) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakeDB: no prepared statements")
+}
+
+func (f *fakeDB) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries++
+	for _, table := range f.tables {
+		if strings.Contains(query, table.name) {
+			return &fakeRows{columns: table.columns, rows: table.rows}, nil
+		}
+	}
+	return nil, errors.New("fakeDB: unexpected query " + query)
+}
+
+func (f *fakeDB) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queries := f.queries
+	f.queries = 0
+	return queries
+}
+
+type fakeRows struct {
+	columns int
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return make([]string, r.columns) }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestAccessCached(t *testing.T) {
+	cache.SetShared(cache.New(cache.NewMemoryStore(100), time.Minute, nil))
+	defer cache.SetShared(cache.New(nil, 0, nil))
+
+	tender_id := uuid.New()
+	fake := &fakeDB{tables: []fakeTable{
+		{"tender_owners", 2, [][]driver.Value{{int64(2), []byte("{bids}")}}},
+		{"tender_invitations", 2, [][]driver.Value{{int64(3), time.Now()}}},
+		{"organization_responsible", 1, [][]driver.Value{{int64(3)}}},
+		{"FROM tenders", 11, [][]driver.Value{{tender_id.String(), "Tender", "", "Published", "Construction",
+			VisibilityInviteOnly, false, int64(1), int64(1), int64(1), time.Now()}}},
+		{"employee", 1, [][]driver.Value{{int64(4)}}},
+	}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	check := func() *Access {
+		t.Helper()
+		access, err_info := GetAccess(dbhelp.WithRequestCache(context.Background()), db, "user4", tender_id)
+		if err_info.Status != 200 {
+			t.Fatalf("GetAccess: %v", err_info.Code)
+		}
+		return access
+	}
+	if access := check(); access.UserID != 4 || !access.Invited || access.Responsible {
+		t.Errorf("first check: %+v", access)
+	}
+	if queries := fake.count(); queries != 5 {
+		t.Errorf("first check ran %d queries", queries)
+	}
+	if access := check(); !access.Invited || access.Tender == nil || access.Tender.ID != tender_id {
+		t.Errorf("repeated check: %+v", access)
+	}
+	if queries := fake.count(); queries != 0 {
+		t.Errorf("repeated check ran %d queries", queries)
+	}
+
+	// The user leaves the invited organization.
+	fake.tables[2].rows = nil
+	dbhelp.InvalidateOrganizations(context.Background(), 4)
+	if access := check(); access.Invited || access.VisibleErr().Status == 200 {
+		t.Errorf("check after leaving: %+v", access)
+	}
+	if queries := fake.count(); queries != 1 {
+		t.Errorf("check after leaving ran %d queries", queries)
+	}
+}
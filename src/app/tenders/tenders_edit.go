@@ -1,54 +1,42 @@
 package tenders
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
-	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
-func archiveTender(db *sql.DB, tender *Tender) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
+func archiveTender(ctx context.Context, db dbhelp.Querier, tender *Tender) errinfo.ErrorInfo {
 	query := `
 		INSERT INTO tenders_archive (id,name, description, status, service_type, version)
 		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id`
 
-	err := db.QueryRow(query, tender.ID, tender.Name, tender.Description, tender.Status, tender.ServiceType, tender.Version).Scan(&tender.ID)
-	err_info.Status = dbhelp.SqlErrToStatus(err, http.StatusInternalServerError)
-	if err_info.Status != 200 {
-		err_info.Reason = errinfo.ErrMessageServer
-	}
-	return err_info
+	err := db.QueryRowContext(ctx, query, tender.ID, tender.Name, tender.Description, tender.Status, tender.ServiceType, tender.Version).Scan(&tender.ID)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 
 }
 
-func updateTender(db *sql.DB, tender *Tender) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
+func updateTender(ctx context.Context, db dbhelp.Querier, tender *Tender) errinfo.ErrorInfo {
 	query := `UPDATE tenders 
-	SET name = $1, description = $2, service_type = $3, version = $4
-	WHERE id = $5
+	SET name = $1, description = $2, service_type = $3, visibility = $4, requires_qualification = $5, version = $6
+	WHERE id = $7
 	`
-	_, err := db.Exec(query, tender.Name, tender.Description, tender.ServiceType, tender.Version, tender.ID)
-	if err != nil {
-		log.Println(err)
-	}
-	err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-	err_info.Reason = errinfo.ErrMessageServer
-	return err_info
+	_, err := db.ExecContext(ctx, query, tender.Name, tender.Description, tender.ServiceType, tender.Visibility,
+		tender.RequiresQualification, tender.Version, tender.ID)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 
 }
 
-func editTender(db *sql.DB, tender *Tender, req_body *editTenderRequestBody) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
-	err_info.Status = 200
-
-	err_info = archiveTender(db, tender)
+func editTender(ctx context.Context, db dbhelp.Querier, tender *Tender, req_body *editTenderRequestBody) errinfo.ErrorInfo {
+	err_info := archiveTender(ctx, db, tender)
 	if err_info.Status != 200 {
 		return err_info
 	}
@@ -63,62 +51,64 @@ func editTender(db *sql.DB, tender *Tender, req_body *editTenderRequestBody) err
 	if req_body.ServiceType != "" {
 		tender.ServiceType = req_body.ServiceType
 	}
-
-	err_info = updateTender(db, tender)
-	log.Println("CantUpdate", tender.OrganizationID)
-	return err_info
-}
-
-func validateEditTenderParams(req_body *editTenderRequestBody) bool {
-
-	if req_body.Description != "" && len(req_body.Description) > 100 {
-		return false
+	if req_body.Visibility != "" {
+		tender.Visibility = req_body.Visibility
 	}
-	if req_body.Name != "" && len(req_body.Name) > 100 {
-		return false
+	if req_body.RequiresQualification != nil {
+		tender.RequiresQualification = *req_body.RequiresQualification
 	}
-	if helpers.IsOkServiceType(req_body.ServiceType) {
-		return true
-	}
-	return false
 
+	return updateTender(ctx, db, tender)
 }
 
 func EditTendersHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
 		vars := mux.Vars(r)
 		s_tender_id := vars["tenderId"]
 		user_name := r.URL.Query().Get("username")
 
 		var req_body editTenderRequestBody
 		tender_id, err_info := helpers.ParseUUID(s_tender_id)
-		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil || err_info.Status != 200 || !validateEditTenderParams(&req_body) {
-			err_info.Reason = errinfo.ErrMessageWrongRequest
-			err_info.Status = 400
-			errinfo.SendHttpErr(w, err_info)
-			return
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			err_info = errinfo.New(errinfo.CodeWrongRequest)
 		}
-
-		tender, err_info := GetTender(db, tender_id)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
 
-		_, err_info = dbhelp.IsUserExistAndResponsible(db, user_name, tender.OrganizationID)
-
+		access, err_info := GetAccess(r.Context(), db, user_name, tender_id)
+		if err_info.Status == 200 {
+			err_info = access.TenderAllow(RightEdit)
+		}
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
-
-		err_info = editTender(db, tender, &req_body)
+		tender := access.Tender
+
+		before := *tender
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			*tender = before
+			if err_info := editTender(r.Context(), tx, tender, &req_body); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderEdit,
+				Before:         before,
+				After:          tender,
+			})
+		})
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
+		invalidateTender(r.Context(), tender.ID)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(tender)
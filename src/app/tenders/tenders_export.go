@@ -0,0 +1,62 @@
+package tenders
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/export"
+)
+
+// UserTendersTable selects the tenders created by the user, a NULL limit
+// selects all of them.
+func UserTendersTable(ctx context.Context, db *sql.DB, user_id int, limit sql.NullInt64, offset int) (*export.Table, errinfo.ErrorInfo) {
+	query := `
+	SELECT id, name, description, status, service_type, visibility, requires_qualification, organization_id, version, created_at
+	FROM tenders
+	WHERE author_id = $1
+	ORDER BY name
+	LIMIT $2 OFFSET $3
+	`
+	rows, err := db.QueryContext(ctx, query, user_id, limit, offset)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	header := []string{"id", "name", "description", "status", "service_type", "visibility", "requires_qualification", "organization_id", "version", "created_at"}
+	return &export.Table{Name: "tenders", Header: header, Rows: rows, Scan: func() ([]interface{}, error) {
+		var tender Tender
+		err := rows.Scan(&tender.ID, &tender.Name, &tender.Description, &tender.Status, &tender.ServiceType,
+			&tender.Visibility, &tender.RequiresQualification, &tender.OrganizationID, &tender.Version, &tender.CreatedAt)
+		return []interface{}{tender.ID.String(), tender.Name, tender.Description, tender.Status, tender.ServiceType,
+			tender.Visibility, tender.RequiresQualification, tender.OrganizationID, tender.Version, tender.CreatedAt}, err
+	}}, errinfo.Ok()
+}
+
+// ExportTendersHandler streams the tenders of /api/tenders/my as CSV or XLSX.
+func ExportTendersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err_info := export.ParseFormat(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		limit, offset, err_info := export.LimitOffset(r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		user_id, err_info := dbhelp.GetUserId(r.Context(), db, r.URL.Query().Get("username"))
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		table, err_info := UserTendersTable(r.Context(), db, user_id, limit, offset)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		export.Send(w, r, format, table)
+	}
+}
@@ -0,0 +1,279 @@
+package tenders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_server/m/api"
+	"go_server/m/audit"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/requestid"
+	"go_server/m/logging"
+	"go_server/m/metrics"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ImportMaxRows bounds one import, bigger files have to be split.
+	ImportMaxRows = 1000
+	importMaxSize = 10 << 20
+
+	ImportAtomic     = "atomic"
+	ImportBestEffort = "best_effort"
+
+	ImportRowCreated = "created"
+	ImportRowValid   = "valid"
+	ImportRowFailed  = "failed"
+)
+
+// importColumns are the CSV header names, the fields of createTenderRequest.
+var importColumns = []string{"name", "description", "serviceType", "status", "organizationId", "creatorUsername", "visibility", "requiresQualification"}
+
+type ImportRow struct {
+	Row    int                  `json:"row"`
+	Status string               `json:"status"`
+	ID     *uuid.UUID           `json:"id,omitempty"`
+	Errors []errinfo.FieldError `json:"errors,omitempty"`
+}
+
+// ImportReport describes every row. Committed is false for a dry run and
+// for an atomic import with failed rows, then nothing was written.
+type ImportReport struct {
+	Mode      string      `json:"mode"`
+	DryRun    bool        `json:"dryRun"`
+	Committed bool        `json:"committed"`
+	Total     int         `json:"total"`
+	Created   int         `json:"created"`
+	Failed    int         `json:"failed"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+// ParseImport reads a JSON array of createTenderRequest objects or a CSV
+// file with importColumns as the header. Values stay as decoded, so they are
+// validated against the same schema as NewTenderHandler requests.
+func ParseImport(content_type string, r io.Reader) ([]map[string]interface{}, errinfo.ErrorInfo) {
+	media_type, _, _ := mime.ParseMediaType(content_type)
+	var rows []map[string]interface{}
+	switch media_type {
+	case "application/json":
+		if err := json.NewDecoder(r).Decode(&rows); err != nil {
+			return nil, errinfo.New(errinfo.CodeWrongRequest)
+		}
+	case "text/csv":
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, errinfo.New(errinfo.CodeValidationFailed).WithField("header", "Missing CSV header.")
+		}
+		for i := range header {
+			header[i] = strings.TrimSpace(header[i])
+			if !slices.Contains(importColumns, header[i]) {
+				return nil, errinfo.New(errinfo.CodeValidationFailed).WithField("header", "Unknown column "+header[i]+".")
+			}
+		}
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, errinfo.New(errinfo.CodeValidationFailed).WithField("", err.Error())
+			}
+			row := map[string]interface{}{}
+			for i, name := range header {
+				if name == "visibility" && record[i] == "" {
+					continue
+				}
+				if name == "requiresQualification" {
+					if required, err := strconv.ParseBool(record[i]); err == nil {
+						row[name] = required
+						continue
+					}
+				}
+				if name == "organizationId" {
+					if id, err := strconv.Atoi(record[i]); err == nil {
+						row[name] = float64(id)
+						continue
+					}
+				}
+				row[name] = record[i]
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, errinfo.New(errinfo.CodeWrongRequest)
+	}
+	if len(rows) > ImportMaxRows {
+		return nil, errinfo.New(errinfo.CodeValidationFailed).WithField("", fmt.Sprintf("At most %d rows per import.", ImportMaxRows))
+	}
+	return rows, errinfo.Ok()
+}
+
+type importCandidate struct {
+	report *ImportRow
+	req    CreateTenderData
+	user   int
+	tender *Tender
+}
+
+type responsibleCheck struct {
+	user_id  int
+	err_info errinfo.ErrorInfo
+}
+
+// checkImportRow applies the rules of NewTenderHandler: the request schema,
+// then the creator being responsible for the organization.
+func checkImportRow(ctx context.Context, db *sql.DB, row map[string]interface{}, responsible map[string]responsibleCheck) (req CreateTenderData, user_id int, fields []errinfo.FieldError, err error) {
+	if fields, err = api.ValidateSchema("createTenderRequest", row); err != nil || len(fields) != 0 {
+		return
+	}
+	data, _ := json.Marshal(row)
+	if err = json.Unmarshal(data, &req); err != nil {
+		return
+	}
+	key := req.CreatorUsername + "\x00" + strconv.Itoa(req.OrganizationID)
+	check, ok := responsible[key]
+	if !ok {
+		check.user_id, check.err_info = dbhelp.IsUserExistAndResponsible(ctx, db, req.CreatorUsername, req.OrganizationID)
+		responsible[key] = check
+	}
+	if check.err_info.Code == errinfo.CodeServer {
+		err = fmt.Errorf("can't check %s", req.CreatorUsername)
+	} else if check.err_info.Status != 200 {
+		fields = []errinfo.FieldError{{Field: "creatorUsername", Message: check.err_info.Reason}}
+	}
+	user_id = check.user_id
+	return
+}
+
+// ImportTenders creates the valid rows in one transaction, each behind a
+// savepoint so a failing insert only discards its own row. An atomic import
+// with any failed row and a dry run roll everything back.
+func ImportTenders(ctx context.Context, db *sql.DB, request_id string, rows []map[string]interface{}, mode string, dry_run bool) (report ImportReport, err_info errinfo.ErrorInfo) {
+	report = ImportReport{Mode: mode, DryRun: dry_run, Total: len(rows), Rows: make([]ImportRow, len(rows))}
+	responsible := map[string]responsibleCheck{}
+	var candidates []importCandidate
+	for i, row := range rows {
+		report.Rows[i] = ImportRow{Row: i + 1, Status: ImportRowValid}
+		req, user_id, fields, err := checkImportRow(ctx, db, row, responsible)
+		if err != nil {
+			logging.FromContext(ctx).Error("import: can't check row", "row", i+1, "err", err)
+			return report, errinfo.New(errinfo.CodeServer)
+		}
+		if len(fields) != 0 {
+			report.Rows[i].Status, report.Rows[i].Errors = ImportRowFailed, fields
+			continue
+		}
+		candidates = append(candidates, importCandidate{report: &report.Rows[i], req: req, user: user_id})
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return report, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer tx.Rollback()
+	for i := range candidates {
+		candidate := &candidates[i]
+		tender := createTenderDataToTender(candidate.req, candidate.user, 1, time.Now())
+		tender.OrganizationID = candidate.req.OrganizationID
+		if _, err = tx.ExecContext(ctx, `SAVEPOINT import_row`); err != nil {
+			return report, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		savepoint_end := `RELEASE SAVEPOINT import_row`
+		if err_info = createTender(ctx, tx, tender); err_info.Status != 200 {
+			savepoint_end = `ROLLBACK TO SAVEPOINT import_row`
+			candidate.report.Status = ImportRowFailed
+			candidate.report.Errors = []errinfo.FieldError{{Message: err_info.Reason}}
+		} else {
+			candidate.tender = tender
+		}
+		if _, err = tx.ExecContext(ctx, savepoint_end); err != nil {
+			return report, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+	}
+	for _, row := range report.Rows {
+		if row.Status == ImportRowFailed {
+			report.Failed++
+		}
+	}
+	if dry_run || (mode == ImportAtomic && report.Failed != 0) {
+		return report, errinfo.Ok()
+	}
+	// The entries are written in the import transaction, a row is created
+	// only together with its entry.
+	for _, candidate := range candidates {
+		tender := candidate.tender
+		if tender == nil {
+			continue
+		}
+		err_info := audit.Append(ctx, tx, request_id, audit.Event{
+			Actor:          candidate.req.CreatorUsername,
+			OrganizationID: tender.OrganizationID,
+			EntityType:     audit.EntityTender,
+			EntityID:       tender.ID.String(),
+			Action:         audit.ActionTenderCreate,
+			After:          tender,
+		})
+		if err_info.Status != 200 {
+			return report, err_info
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return report, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+
+	report.Committed = true
+	for _, candidate := range candidates {
+		tender := candidate.tender
+		if tender == nil {
+			continue
+		}
+		report.Created++
+		candidate.report.Status = ImportRowCreated
+		candidate.report.ID = &tender.ID
+		metrics.TendersCreated.Inc()
+		if tender.Status == "Published" {
+			metrics.TendersPublished.Inc()
+		}
+	}
+	return report, errinfo.Ok()
+}
+
+// ImportTendersHandler takes a JSON or CSV body; mode is atomic (default)
+// or best_effort and dryRun=true only reports what would happen.
+func ImportTendersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = ImportAtomic
+		}
+		if mode != ImportAtomic && mode != ImportBestEffort {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeValidationFailed).WithField("mode", "Must be atomic or best_effort."))
+			return
+		}
+		rows, err_info := ParseImport(r.Header.Get("Content-Type"), http.MaxBytesReader(w, r.Body, importMaxSize))
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		report, err_info := ImportTenders(r.Context(), db, requestid.FromRequest(r), rows, mode, r.URL.Query().Get("dryRun") == "true")
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,25 @@
+package tenders
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	rows, err_info := ParseImport("text/csv; charset=utf-8", strings.NewReader(
+		"name, organizationId ,creatorUsername\nRoads,1,user1\nBridges,one,user2\n"))
+	if err_info.Status != 200 {
+		t.Fatal(err_info.Reason, err_info.Fields)
+	}
+	if len(rows) != 2 || rows[0]["organizationId"] != float64(1) || rows[1]["organizationId"] != "one" || rows[1]["name"] != "Bridges" {
+		t.Errorf("rows = %v", rows)
+	}
+	_, err_info = ParseImport("text/csv", strings.NewReader("name,budget\nRoads,1\n"))
+	if err_info.Status != 400 {
+		t.Errorf("unknown column: status %d", err_info.Status)
+	}
+	_, err_info = ParseImport("text/plain", strings.NewReader("name\nRoads\n"))
+	if err_info.Status != 400 {
+		t.Errorf("text/plain: status %d", err_info.Status)
+	}
+}
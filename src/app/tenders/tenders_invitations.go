@@ -0,0 +1,245 @@
+package tenders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go_server/m/audit"
+	"go_server/m/cache"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Invitation lets the responsible employees of a supplier organization see
+// an invite-only tender and bid on it.
+type Invitation struct {
+	OrganizationID int       `json:"organizationId"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func invitationsKey(tender_id uuid.UUID) string {
+	return "invitations:" + tender_id.String()
+}
+
+// invalidateInvitations is called once a change of the invitations is
+// committed.
+func invalidateInvitations(ctx context.Context, tender_id uuid.UUID) {
+	dbhelp.CacheForget(ctx, invitationsKey(tender_id))
+	cache.Invalidate(ctx, invitationsKey(tender_id))
+}
+
+// GetInvitations returns the organizations invited to the tender.
+func GetInvitations(ctx context.Context, db *sql.DB, tender_id uuid.UUID) ([]Invitation, errinfo.ErrorInfo) {
+	if invitations, ok := dbhelp.CacheGet[[]Invitation](ctx, invitationsKey(tender_id)); ok {
+		return invitations, errinfo.Ok()
+	}
+	if invitations, ok := cache.Get[[]Invitation](ctx, invitationsKey(tender_id)); ok {
+		dbhelp.CachePut(ctx, invitationsKey(tender_id), invitations)
+		return invitations, errinfo.Ok()
+	}
+	generation := cache.Generation(invitationsKey(tender_id))
+	query := `
+	SELECT organization_id, created_at
+	FROM tender_invitations
+	WHERE tender_id = $1
+	ORDER BY organization_id
+	`
+	rows, err := db.QueryContext(ctx, query, tender_id)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+	invitations := []Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		if err := rows.Scan(&invitation.OrganizationID, &invitation.CreatedAt); err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		invitations = append(invitations, invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	dbhelp.CachePut(ctx, invitationsKey(tender_id), invitations)
+	cache.Put(ctx, invitationsKey(tender_id), generation, invitations)
+	return invitations, errinfo.Ok()
+}
+
+// invite keeps the first invitation of an organization invited again.
+func invite(ctx context.Context, db dbhelp.Querier, tender_id uuid.UUID, invitation *Invitation) errinfo.ErrorInfo {
+	query := `
+	INSERT INTO tender_invitations (tender_id, organization_id)
+	VALUES ($1, $2)
+	ON CONFLICT (tender_id, organization_id) DO UPDATE SET created_at = tender_invitations.created_at
+	RETURNING created_at
+	`
+	err := db.QueryRowContext(ctx, query, tender_id, invitation.OrganizationID).Scan(&invitation.CreatedAt)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+}
+
+func uninvite(ctx context.Context, db dbhelp.Querier, tender_id uuid.UUID, organization_id int) errinfo.ErrorInfo {
+	query := `
+	DELETE FROM tender_invitations
+	WHERE tender_id = $1 AND organization_id = $2
+	RETURNING organization_id
+	`
+	err := db.QueryRowContext(ctx, query, tender_id, organization_id).Scan(&organization_id)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeNotFound)
+}
+
+// findInvitation returns the invitation of organization_id, or nil.
+func findInvitation(invitations []Invitation, organization_id int) *Invitation {
+	for i := range invitations {
+		if invitations[i].OrganizationID == organization_id {
+			return &invitations[i]
+		}
+	}
+	return nil
+}
+
+// invitationParams resolves the tender, the caller allowed to edit it and
+// the organization of the route.
+func invitationParams(db *sql.DB, r *http.Request) (access *Access, organization_id int, err_info errinfo.ErrorInfo) {
+	vars := mux.Vars(r)
+	tender_id, err_info := helpers.ParseUUID(vars["tenderId"])
+	if err_info.Status != 200 {
+		return
+	}
+	organization_id, err_info = helpers.Atoi(vars["organizationId"])
+	if err_info.Status != 200 {
+		return
+	}
+	access, err_info = GetAccess(r.Context(), db, r.URL.Query().Get("username"), tender_id)
+	if err_info.Status == 200 {
+		err_info = access.TenderAllow(RightEdit)
+	}
+	return
+}
+
+// InvitationsHandler lists the invited organizations to every organization
+// of the tender.
+func InvitationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tender_id, err_info := helpers.ParseUUID(mux.Vars(r)["tenderId"])
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		access, err_info := GetAccess(r.Context(), db, r.URL.Query().Get("username"), tender_id)
+		if err_info.Status == 200 {
+			err_info = access.TenderErr()
+		}
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		invitations, err_info := GetInvitations(r.Context(), db, tender_id)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		if invitations == nil {
+			invitations = []Invitation{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invitations)
+	}
+}
+
+// InviteHandler lets the organizations allowed to edit the tender invite a
+// supplier. Inviting one again changes nothing.
+func InviteHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access, organization_id, err_info := invitationParams(db, r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		tender := access.Tender
+		owners, err_info := GetOwners(r.Context(), db, tender.ID)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		if organization_id == tender.OrganizationID || findOwner(owners, organization_id) != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeValidationFailed).
+				WithField("organizationId", "Owns the tender."))
+			return
+		}
+		if _, err_info = dbhelp.GetOrganization(r.Context(), db, organization_id); err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		invitation := Invitation{OrganizationID: organization_id}
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := invite(r.Context(), tx, tender.ID, &invitation); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          access.UserName,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderInvitation,
+				After:          invitation,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		invalidateInvitations(r.Context(), tender.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invitation)
+	}
+}
+
+// UninviteHandler lets the organizations allowed to edit the tender
+// withdraw an invitation.
+func UninviteHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access, organization_id, err_info := invitationParams(db, r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		tender := access.Tender
+		invitations, err_info := GetInvitations(r.Context(), db, tender.ID)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		invitation := findInvitation(invitations, organization_id)
+		if invitation == nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeNotFound))
+			return
+		}
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := uninvite(r.Context(), tx, tender.ID, organization_id); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          access.UserName,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderInvitation,
+				Before:         invitation,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		invalidateInvitations(r.Context(), tender.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invitation)
+	}
+}
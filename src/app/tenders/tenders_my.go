@@ -1,6 +1,7 @@
 package tenders
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"go_server/m/common/dbhelp"
@@ -9,18 +10,16 @@ import (
 	"net/http"
 )
 
-func getUserTenders(db *sql.DB, user_id, limit, offset int) ([]Tender, errinfo.ErrorInfo) {
-	var err_info errinfo.ErrorInfo
-	err_info.Reason = errinfo.ErrMessageServer
+func getUserTenders(ctx context.Context, db *sql.DB, user_id, limit, offset int) ([]Tender, errinfo.ErrorInfo) {
 	query := `
-	SELECT id, name, description, status, service_type, author_id, version, created_at
+	SELECT id, name, description, status, service_type, visibility, requires_qualification, author_id, version, created_at
 	FROM tenders
 	WHERE author_id = $1
 	ORDER BY name
 	LIMIT $2 OFFSET $3
 	`
-	rows, err := db.Query(query, user_id, limit, offset)
-	err_info.Status = dbhelp.SqlErrToStatus(err, 200)
+	rows, err := db.QueryContext(ctx, query, user_id, limit, offset)
+	err_info := dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 	if err_info.Status != 200 {
 		return nil, err_info
 	}
@@ -28,13 +27,12 @@ func getUserTenders(db *sql.DB, user_id, limit, offset int) ([]Tender, errinfo.E
 	var tenders []Tender
 	for rows.Next() {
 		var tender Tender
-		if err := rows.Scan(&tender.ID, &tender.Name, &tender.Description, &tender.Status, &tender.ServiceType, &tender.AuthorID, &tender.Version, &tender.CreatedAt); err != nil {
-			err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-			return nil, err_info
+		if err := rows.Scan(&tender.ID, &tender.Name, &tender.Description, &tender.Status, &tender.ServiceType, &tender.Visibility, &tender.RequiresQualification, &tender.AuthorID, &tender.Version, &tender.CreatedAt); err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		}
 		tenders = append(tenders, tender)
 	}
-	err_info.Status = dbhelp.SqlErrToStatus(rows.Err(), 500)
+	err_info = dbhelp.SqlErrToErrInfo(rows.Err(), errinfo.CodeServer)
 	return tenders, err_info
 
 }
@@ -43,8 +41,6 @@ func MyTendersHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		var err_info errinfo.ErrorInfo
-
 		w.Header().Set("Content-Type", "application/json")
 
 		limit, offset, err_info := helpers.GetLimitOffsetFromRequest(r)
@@ -52,11 +48,11 @@ func MyTendersHandler(db *sql.DB) http.HandlerFunc {
 		var user_id int
 		if err_info.Status == 200 {
 			user_name := r.URL.Query().Get("username")
-			user_id, err_info = dbhelp.GetUserId(db, user_name)
+			user_id, err_info = dbhelp.GetUserId(r.Context(), db, user_name)
 
 		}
 		if err_info.Status == 200 {
-			tenders, err_info = getUserTenders(db, user_id, limit, offset)
+			tenders, err_info = getUserTenders(r.Context(), db, user_id, limit, offset)
 		}
 
 		if err_info.Status != 200 {
@@ -1,65 +1,64 @@
 package tenders
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
+	"go_server/m/metrics"
 	"net/http"
 	"time"
 )
 
-func createTender(db *sql.DB, tender *Tender) errinfo.ErrorInfo {
-	var err_info errinfo.ErrorInfo
+func createTender(ctx context.Context, db dbhelp.Querier, tender *Tender) errinfo.ErrorInfo {
 	query := `
-		INSERT INTO tenders (name, description, status, service_type, author_id,organization_id, version, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7,$8)
+		INSERT INTO tenders (name, description, status, service_type, visibility, requires_qualification, author_id, organization_id, version, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id`
 
-	err := db.QueryRow(query, tender.Name, tender.Description, tender.Status, tender.ServiceType, tender.AuthorID, tender.OrganizationID, tender.Version, tender.CreatedAt).Scan(&tender.ID)
-	err_info.Status = dbhelp.SqlErrToStatus(err, http.StatusInternalServerError)
-	if err_info.Status != 200 {
-		err_info.Reason = errinfo.ErrMessageServer
-	}
-	return err_info
-
-}
-
-func validateNewTender(new_tender *CreateTenderData) bool {
-	if len(new_tender.Name) > 100 {
-		return false
-	}
-	if len(new_tender.Description) > 100 {
-		return false
-	}
+	err := db.QueryRowContext(ctx, query, tender.Name, tender.Description, tender.Status, tender.ServiceType, tender.Visibility, tender.RequiresQualification, tender.AuthorID, tender.OrganizationID, tender.Version, tender.CreatedAt).Scan(&tender.ID)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 
-	return true
 }
 
 func NewTenderHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
-		err_info.Status = 200
 		var req CreateTenderData
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validateNewTender(&req) {
-			err_info.Reason = errinfo.ErrMessageWrongRequest
-			err_info.Status = 400
-			errinfo.SendHttpErr(w, err_info)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
 			return
 		}
-		user_id, err_info := dbhelp.IsUserExistAndResponsible(db, req.CreatorUsername, req.OrganizationID)
+		user_id, err_info := dbhelp.IsUserExistAndResponsible(r.Context(), db, req.CreatorUsername, req.OrganizationID)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
 		tender := createTenderDataToTender(req, user_id, 1, time.Now())
 		tender.OrganizationID = req.OrganizationID
-		err_info = createTender(db, tender)
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := createTender(r.Context(), tx, tender); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          req.CreatorUsername,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderCreate,
+				After:          tender,
+			})
+		})
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
+		metrics.TendersCreated.Inc()
+		if tender.Status == "Published" {
+			metrics.TendersPublished.Inc()
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(tender)
@@ -0,0 +1,305 @@
+package tenders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"go_server/m/audit"
+	"go_server/m/cache"
+	"go_server/m/common/dbhelp"
+	"go_server/m/common/errinfo"
+	"go_server/m/common/helpers"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Right is what the responsible employees of an organization may do with a
+// tender besides viewing it, its bids and questions.
+type Right string
+
+const (
+	// RightEdit covers editing and rolling back the tender, attaching files
+	// and answering questions.
+	RightEdit Right = "edit"
+	// RightStatus covers publishing and closing the tender.
+	RightStatus Right = "status"
+	// RightBids covers changing bids, deciding on them and leaving feedback.
+	// Their employees count towards the decision quorum.
+	RightBids Right = "bids"
+	// RightOwners covers managing the co-owners. Only the tender
+	// organization has it.
+	RightOwners Right = "owners"
+)
+
+// AllRights are those of the tender organization.
+var AllRights = []Right{RightEdit, RightStatus, RightBids, RightOwners}
+
+// coOwnerRights may be granted to a co-owner.
+var coOwnerRights = []Right{RightEdit, RightStatus, RightBids}
+
+// Owner is an organization running the tender together with the tender
+// organization.
+type Owner struct {
+	OrganizationID int     `json:"organizationId"`
+	Rights         []Right `json:"rights"`
+}
+
+type setOwnerRequestBody struct {
+	Rights []Right `json:"rights"`
+}
+
+func toRights(names []string) []Right {
+	rights := make([]Right, len(names))
+	for i, name := range names {
+		rights[i] = Right(name)
+	}
+	return rights
+}
+
+func ownersKey(tender_id uuid.UUID) string {
+	return "owners:" + tender_id.String()
+}
+
+// invalidateOwners is called once a change of the co-owners is committed.
+func invalidateOwners(ctx context.Context, tender_id uuid.UUID) {
+	dbhelp.CacheForget(ctx, ownersKey(tender_id))
+	cache.Invalidate(ctx, ownersKey(tender_id))
+}
+
+// GetOwners returns the co-owners of the tender, without the tender
+// organization.
+func GetOwners(ctx context.Context, db *sql.DB, tender_id uuid.UUID) ([]Owner, errinfo.ErrorInfo) {
+	if owners, ok := dbhelp.CacheGet[[]Owner](ctx, ownersKey(tender_id)); ok {
+		return owners, errinfo.Ok()
+	}
+	if owners, ok := cache.Get[[]Owner](ctx, ownersKey(tender_id)); ok {
+		dbhelp.CachePut(ctx, ownersKey(tender_id), owners)
+		return owners, errinfo.Ok()
+	}
+	generation := cache.Generation(ownersKey(tender_id))
+	query := `
+	SELECT organization_id, rights
+	FROM tender_owners
+	WHERE tender_id = $1
+	ORDER BY organization_id
+	`
+	rows, err := db.QueryContext(ctx, query, tender_id)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+	owners := []Owner{}
+	for rows.Next() {
+		var owner Owner
+		var rights pq.StringArray
+		if err := rows.Scan(&owner.OrganizationID, &rights); err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		owner.Rights = toRights(rights)
+		owners = append(owners, owner)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	dbhelp.CachePut(ctx, ownersKey(tender_id), owners)
+	cache.Put(ctx, ownersKey(tender_id), generation, owners)
+	return owners, errinfo.Ok()
+}
+
+func setOwner(ctx context.Context, db dbhelp.Querier, tender_id uuid.UUID, owner Owner) errinfo.ErrorInfo {
+	query := `
+	INSERT INTO tender_owners (tender_id, organization_id, rights)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (tender_id, organization_id) DO UPDATE SET rights = EXCLUDED.rights
+	`
+	rights := make(pq.StringArray, len(owner.Rights))
+	for i, right := range owner.Rights {
+		rights[i] = string(right)
+	}
+	_, err := db.ExecContext(ctx, query, tender_id, owner.OrganizationID, rights)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+}
+
+func removeOwner(ctx context.Context, db dbhelp.Querier, tender_id uuid.UUID, organization_id int) errinfo.ErrorInfo {
+	query := `
+	DELETE FROM tender_owners
+	WHERE tender_id = $1 AND organization_id = $2
+	RETURNING organization_id
+	`
+	err := db.QueryRowContext(ctx, query, tender_id, organization_id).Scan(&organization_id)
+	return dbhelp.SqlErrToErrInfo(err, errinfo.CodeNotFound)
+}
+
+// findOwner returns the co-owner with organization_id, or nil.
+func findOwner(owners []Owner, organization_id int) *Owner {
+	for i := range owners {
+		if owners[i].OrganizationID == organization_id {
+			return &owners[i]
+		}
+	}
+	return nil
+}
+
+// ownerParams resolves the tender, the caller allowed to manage its
+// co-owners and the organization of the route.
+func ownerParams(db *sql.DB, r *http.Request) (access *Access, organization_id int, err_info errinfo.ErrorInfo) {
+	vars := mux.Vars(r)
+	tender_id, err_info := helpers.ParseUUID(vars["tenderId"])
+	if err_info.Status != 200 {
+		return
+	}
+	organization_id, err_info = helpers.Atoi(vars["organizationId"])
+	if err_info.Status != 200 {
+		return
+	}
+	access, err_info = GetAccess(r.Context(), db, r.URL.Query().Get("username"), tender_id)
+	if err_info.Status == 200 {
+		err_info = access.TenderAllow(RightOwners)
+	}
+	return
+}
+
+// OwnersHandler lists the co-owners to every organization of the tender.
+func OwnersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tender_id, err_info := helpers.ParseUUID(mux.Vars(r)["tenderId"])
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		access, err_info := GetAccess(r.Context(), db, r.URL.Query().Get("username"), tender_id)
+		if err_info.Status == 200 {
+			err_info = access.TenderErr()
+		}
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		owners, err_info := GetOwners(r.Context(), db, tender_id)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		if owners == nil {
+			owners = []Owner{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(owners)
+	}
+}
+
+// SetOwnerHandler lets the tender organization add a co-owner or change
+// its rights.
+func SetOwnerHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req_body setOwnerRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&req_body); err != nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeWrongRequest))
+			return
+		}
+		access, organization_id, err_info := ownerParams(db, r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		tender := access.Tender
+		err_info = errinfo.New(errinfo.CodeValidationFailed)
+		if organization_id == tender.OrganizationID {
+			err_info = err_info.WithField("organizationId", "Is the tender organization.")
+		}
+		for _, right := range req_body.Rights {
+			if !slices.Contains(coOwnerRights, right) {
+				err_info = err_info.WithField("rights", "Must be some of edit, status, bids.")
+				break
+			}
+		}
+		if len(err_info.Fields) != 0 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		if _, err_info = dbhelp.GetOrganization(r.Context(), db, organization_id); err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		owners, err_info := GetOwners(r.Context(), db, tender.ID)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+
+		owner := Owner{OrganizationID: organization_id, Rights: req_body.Rights}
+		slices.Sort(owner.Rights)
+		owner.Rights = slices.Compact(owner.Rights)
+		if owner.Rights == nil {
+			owner.Rights = []Right{}
+		}
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := setOwner(r.Context(), tx, tender.ID, owner); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          access.UserName,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderOwner,
+				Before:         findOwner(owners, organization_id),
+				After:          owner,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		invalidateOwners(r.Context(), tender.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(owner)
+	}
+}
+
+// RemoveOwnerHandler lets the tender organization remove a co-owner.
+func RemoveOwnerHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access, organization_id, err_info := ownerParams(db, r)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		tender := access.Tender
+		owners, err_info := GetOwners(r.Context(), db, tender.ID)
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		owner := findOwner(owners, organization_id)
+		if owner == nil {
+			errinfo.SendHttpErr(w, errinfo.New(errinfo.CodeNotFound))
+			return
+		}
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := removeOwner(r.Context(), tx, tender.ID, organization_id); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          access.UserName,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderOwner,
+				Before:         owner,
+			})
+		})
+		if err_info.Status != 200 {
+			errinfo.SendHttpErr(w, err_info)
+			return
+		}
+		invalidateOwners(r.Context(), tender.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(owner)
+	}
+}
@@ -1,8 +1,10 @@
 package tenders
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
@@ -12,18 +14,16 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func getArchivedTender(db *sql.DB, tender_id uuid.UUID, version int) (tender *Tender, err_info errinfo.ErrorInfo) {
-	err_info.Status = 200
-	err_info.Reason = errinfo.ErrMessageServer
+func getArchivedTender(ctx context.Context, db *sql.DB, tender_id uuid.UUID, version int) (tender *Tender, err_info errinfo.ErrorInfo) {
 	tender = &Tender{}
 	query := `
     SELECT t.name, t.description, t.status, t.service_type
     FROM tenders_archive t
     WHERE t.id = $1 AND t.version = $2
     `
-	rows, err := db.Query(query, tender_id, version)
+	rows, err := db.QueryContext(ctx, query, tender_id, version)
 	if err != nil {
-		err_info.Status = dbhelp.SqlErrToStatus(err, 500)
+		err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		return
 	}
 	defer rows.Close()
@@ -31,33 +31,31 @@ func getArchivedTender(db *sql.DB, tender_id uuid.UUID, version int) (tender *Te
 	if rows.Next() {
 		err := rows.Scan(&tender.Name, &tender.Description, &tender.Status, &tender.ServiceType)
 		tender.Version++
-		if err != nil {
-			err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-			return
-		}
+		err_info = dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
 		return
 	}
-	err_info.Status = 404
-	err_info.Reason = "This version of tender does not exist."
+	err_info = errinfo.New(errinfo.CodeTenderVersionNotFound)
 	return
 }
 
-func rollbackTender(db *sql.DB, current_tender, old_tender *Tender) errinfo.ErrorInfo {
-	err_info := archiveTender(db, current_tender)
+func rollbackTender(ctx context.Context, db dbhelp.Querier, current_tender, old_tender *Tender) errinfo.ErrorInfo {
+	err_info := archiveTender(ctx, db, current_tender)
 	if err_info.Status != 200 {
 		return err_info
 	}
 	old_tender.Version = current_tender.Version + 1
 	old_tender.ID = current_tender.ID
-	err_info = updateTender(db, old_tender)
+	// The archive has no visibility nor qualification requirement, a
+	// rollback keeps the current ones.
+	old_tender.Visibility = current_tender.Visibility
+	old_tender.RequiresQualification = current_tender.RequiresQualification
+	err_info = updateTender(ctx, db, old_tender)
 	return err_info
 }
 
 func RollbackTendersHandler(db *sql.DB) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err_info errinfo.ErrorInfo
-		err_info.Status = 200
 		vars := mux.Vars(r)
 		s_tender_id := vars["tenderId"]
 		s_version := vars["version"]
@@ -72,29 +70,42 @@ func RollbackTendersHandler(db *sql.DB) http.HandlerFunc {
 			errinfo.SendHttpErr(w, tmp_err_info)
 			return
 		}
-		current_tender, err_info := GetTender(db, tender_id)
-		if err_info.Status != 200 {
-			errinfo.SendHttpErr(w, err_info)
-			return
-		}
-
 		user_name := r.URL.Query().Get("username")
-		_, err_info = dbhelp.IsUserExistAndResponsible(db, user_name, current_tender.OrganizationID)
+		access, err_info := GetAccess(r.Context(), db, user_name, tender_id)
+		if err_info.Status == 200 {
+			err_info = access.TenderAllow(RightEdit)
+		}
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
+		current_tender := access.Tender
 
-		old_tender, err_info := getArchivedTender(db, tender_id, version)
+		old_tender, err_info := getArchivedTender(r.Context(), db, tender_id, version)
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
-		err_info = rollbackTender(db, current_tender, old_tender)
+		before := *current_tender
+		err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			if err_info := rollbackTender(r.Context(), tx, current_tender, old_tender); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Record(tx, r, audit.Event{
+				Actor:          user_name,
+				OrganizationID: current_tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       current_tender.ID.String(),
+				Action:         audit.ActionTenderRollback,
+				Before:         before,
+				After:          old_tender,
+			})
+		})
 		if err_info.Status != 200 {
 			errinfo.SendHttpErr(w, err_info)
 			return
 		}
+		invalidateTender(r.Context(), current_tender.ID)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(old_tender)
@@ -1,20 +1,22 @@
 package tenders
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"go_server/m/audit"
 	"go_server/m/common/dbhelp"
 	"go_server/m/common/errinfo"
 	"go_server/m/common/helpers"
-	"log"
+	"go_server/m/logging"
+	"go_server/m/metrics"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-func updateTenderStatus(db *sql.DB, tender_uid uuid.UUID, status string) (string, errinfo.ErrorInfo) {
-	var err_info errinfo.ErrorInfo
-	err_info.Status = 200
+func updateTenderStatus(ctx context.Context, db dbhelp.Querier, tender_uid uuid.UUID, status string) (string, errinfo.ErrorInfo) {
 	query := `
 		UPDATE tenders
 		SET status = $1
@@ -23,65 +25,137 @@ func updateTenderStatus(db *sql.DB, tender_uid uuid.UUID, status string) (string
 	`
 
 	var updatedStatus string
-	err := db.QueryRow(query, status, tender_uid).Scan(&updatedStatus)
-	if err != nil {
-		err_info.Status = dbhelp.SqlErrToStatus(err, 500)
-		err_info.Reason = errinfo.ErrMessageServer
+	err := db.QueryRowContext(ctx, query, status, tender_uid).Scan(&updatedStatus)
+	err_info := dbhelp.SqlErrToErrInfo(err, errinfo.CodeTenderNotFound)
+	if err_info.Status != 200 {
 		return "", err_info
 	}
 
 	return updatedStatus, err_info
 }
 
-func handleGetTenderStatus(db *sql.DB, w http.ResponseWriter, r *http.Request, tender_id uuid.UUID) {
-	var err_info errinfo.ErrorInfo
-	user_name := r.URL.Query().Get("username")
-	if user_name != "" {
-		_, err_info = dbhelp.GetUserId(db, user_name)
+// CloseExpired closes the tenders created before the deadline that are still
+// open. A dry run only returns them.
+func CloseExpired(ctx context.Context, db *sql.DB, deadline time.Time, actor string, dry_run bool) ([]Tender, errinfo.ErrorInfo) {
+	query := `
+	SELECT id, name, description, status, service_type, visibility, requires_qualification, author_id, organization_id, version, created_at
+	FROM tenders
+	WHERE status <> 'Closed' AND created_at < $1
+	ORDER BY created_at
+	`
+	rows, err := db.QueryContext(ctx, query, deadline)
+	if err != nil {
+		return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	defer rows.Close()
+	result := []Tender{}
+	for rows.Next() {
+		var tender Tender
+		if err := rows.Scan(&tender.ID, &tender.Name, &tender.Description, &tender.Status, &tender.ServiceType,
+			&tender.Visibility, &tender.RequiresQualification, &tender.AuthorID, &tender.OrganizationID, &tender.Version, &tender.CreatedAt); err != nil {
+			return nil, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+		}
+		result = append(result, tender)
+	}
+	if err = rows.Err(); err != nil || dry_run {
+		return result, dbhelp.SqlErrToErrInfo(err, errinfo.CodeServer)
+	}
+	rows.Close()
+
+	for i := range result {
+		before := result[i]
+		tender := &result[i]
+		err_info := dbhelp.InTxInfo(ctx, db, func(tx *sql.Tx) errinfo.ErrorInfo {
+			var err_info errinfo.ErrorInfo
+			if tender.Status, err_info = updateTenderStatus(ctx, tx, tender.ID, "Closed"); err_info.Status != 200 {
+				return err_info
+			}
+			return audit.Append(ctx, tx, "", audit.Event{
+				Actor:          actor,
+				OrganizationID: tender.OrganizationID,
+				EntityType:     audit.EntityTender,
+				EntityID:       tender.ID.String(),
+				Action:         audit.ActionTenderStatus,
+				Before:         before,
+				After:          tender,
+			})
+		})
 		if err_info.Status != 200 {
-			err_info.Reason = errinfo.ErrMessageWrongUser
-			errinfo.SendHttpErr(w, err_info)
-			return
+			return result[:i], err_info
 		}
+		invalidateTender(ctx, tender.ID)
+	}
+	return result, errinfo.Ok()
+}
+
+// handleGetTenderStatus answers anyone for a public tender, otherwise only
+// the users who see it.
+func handleGetTenderStatus(db *sql.DB, w http.ResponseWriter, r *http.Request, tender_id uuid.UUID) {
+	user_name := r.URL.Query().Get("username")
+	access, err_info := GetAccess(r.Context(), db, user_name, tender_id)
+	if err_info.Status == 200 && user_name != "" && access.UserID == 0 {
+		err_info = errinfo.New(errinfo.CodeWrongUser)
+	}
+	if err_info.Status == 200 {
+		err_info = access.VisibleErr()
 	}
-	tender, err_info := GetTender(db, tender_id)
 	if err_info.Status != 200 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
 
-	w.Write([]byte(tender.Status))
+	json.NewEncoder(w).Encode(access.Tender.Status)
 }
 
 func handlePutTenderStatus(db *sql.DB, w http.ResponseWriter, r *http.Request, tender_id uuid.UUID) {
-	var err_info errinfo.ErrorInfo
 	user_name := r.URL.Query().Get("username")
 	new_status := r.URL.Query().Get("status")
-	if user_name == "" || !helpers.IsNewStatusOk(new_status) {
-		err_info.Status = 400
-		err_info.Reason = errinfo.ErrMessageWrongRequest
-		errinfo.SendHttpErr(w, err_info)
-		return
+	err_info := errinfo.New(errinfo.CodeValidationFailed)
+	if user_name == "" {
+		err_info = err_info.WithField("username", "Required.")
 	}
-
-	tender, err_info := GetTender(db, tender_id)
-	if err_info.Status != 200 {
+	if !helpers.IsNewStatusOk(new_status) {
+		err_info = err_info.WithField("status", "Must be one of Created, Published, Closed.")
+	}
+	if len(err_info.Fields) != 0 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
 
-	_, err_info = dbhelp.IsUserExistAndResponsible(db, user_name, tender.OrganizationID)
+	access, err_info := GetAccess(r.Context(), db, user_name, tender_id)
+	if err_info.Status == 200 {
+		err_info = access.TenderAllow(RightStatus)
+	}
 	if err_info.Status != 200 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
+	tender := access.Tender
 
-	new_status, err_info = updateTenderStatus(db, tender.ID, new_status)
+	before := *tender
+	err_info = dbhelp.InTxInfo(r.Context(), db, func(tx *sql.Tx) errinfo.ErrorInfo {
+		var err_info errinfo.ErrorInfo
+		if tender.Status, err_info = updateTenderStatus(r.Context(), tx, tender.ID, new_status); err_info.Status != 200 {
+			return err_info
+		}
+		return audit.Record(tx, r, audit.Event{
+			Actor:          user_name,
+			OrganizationID: tender.OrganizationID,
+			EntityType:     audit.EntityTender,
+			EntityID:       tender.ID.String(),
+			Action:         audit.ActionTenderStatus,
+			Before:         before,
+			After:          tender,
+		})
+	})
 	if err_info.Status != 200 {
 		errinfo.SendHttpErr(w, err_info)
 		return
 	}
-	tender.Status = new_status
+	invalidateTender(r.Context(), tender.ID)
+	if before.Status != "Published" && tender.Status == "Published" {
+		metrics.TendersPublished.Inc()
+	}
 	json.NewEncoder(w).Encode(tender)
 }
 
@@ -90,7 +164,7 @@ func StatusTendersHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s_tender_id := r.URL.Path[len("/api/tenders/") : len(r.URL.Path)-len("/status")]
 		tender_id, _ := helpers.ParseUUID(s_tender_id)
-		log.Println("status handling ", s_tender_id)
+		logging.FromRequest(r).Debug("tender status", "tender_id", s_tender_id)
 		w.Header().Set("Content-Type", "application/json")
 		if r.Method == http.MethodGet {
 			handleGetTenderStatus(db, w, r, tender_id)
@@ -0,0 +1,153 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const ServiceName = "tender-service"
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Init installs the global tracer provider. The OTLP exporter is configured by
+// the standard OTEL_EXPORTER_OTLP_* variables (http://localhost:4318 by
+// default). With ExporterNone tracing stays a no-op.
+func Init(ctx context.Context, exporter_name string) (shutdown func(context.Context) error, err error) {
+	shutdown = func(context.Context) error { return nil }
+	var exporter sdktrace.SpanExporter
+	switch exporter_name {
+	case ExporterNone, "":
+		return shutdown, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		err = fmt.Errorf("unknown trace exporter %q", exporter_name)
+	}
+	if err != nil {
+		return shutdown, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return shutdown, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// routeAttributes maps mux path variables to span attributes.
+var routeAttributes = map[string]attribute.Key{
+	"tenderId": "tender.id",
+	"bidId":    "bid.id",
+	"version":  "entity.version",
+}
+
+// Middleware starts a server span named after the route template and tags it
+// with the entity IDs from the path and the acting user.
+func Middleware() mux.MiddlewareFunc {
+	server_spans := otelmux.Middleware(ServiceName)
+	return func(next http.Handler) http.Handler {
+		return server_spans(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+			for name, value := range mux.Vars(r) {
+				if key, ok := routeAttributes[name]; ok {
+					span.SetAttributes(key.String(value))
+				}
+			}
+			query := r.URL.Query()
+			for _, name := range []string{"username", "requesterUsername"} {
+				if user_name := query.Get(name); user_name != "" {
+					span.SetAttributes(semconv.EnduserID(user_name))
+					break
+				}
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+var tablePattern = regexp.MustCompile(`(?is)\b(?:FROM|INTO|UPDATE)\s+([a-z_][a-z0-9_.]*)`)
+
+// operationName turns a query into "SELECT tenders", "UPDATE bids" and so on.
+func operationName(query string) (operation, table string) {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	operation = strings.ToUpper(fields[0])
+	if match := tablePattern.FindStringSubmatch(query); match != nil {
+		table = strings.ToLower(match[1])
+	}
+	return operation, table
+}
+
+func spanName(ctx context.Context, method otelsql.Method, query string) string {
+	operation, table := operationName(query)
+	if operation == "" {
+		return string(method)
+	}
+	if table == "" {
+		return operation
+	}
+	return operation + " " + table
+}
+
+func queryAttributes(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) []attribute.KeyValue {
+	operation, table := operationName(query)
+	result := []attribute.KeyValue{}
+	if operation != "" {
+		result = append(result, semconv.DBOperationName(operation))
+	}
+	if table != "" {
+		result = append(result, semconv.DBCollectionName(table))
+	}
+	return result
+}
+
+// OpenDB opens the database through a driver wrapper that records a span
+// for every query, named after the SQL operation and table.
+func OpenDB(connector driver.Connector) *sql.DB {
+	return otelsql.OpenDB(connector,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanNameFormatter(spanName),
+		otelsql.WithAttributesGetter(queryAttributes),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			Ping:                 true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOperationName(t *testing.T) {
+	cases := []struct {
+		query     string
+		operation string
+		table     string
+	}{
+		{"SELECT COUNT(*) \n\t\tFROM tenders t JOIN organization_responsible orgr ON true", "SELECT", "tenders"},
+		{"\n\t\tUPDATE bids\n\t\tSET approve_count = $1", "UPDATE", "bids"},
+		{"INSERT INTO bids_reviews (bid_id) VALUES ($1)", "INSERT", "bids_reviews"},
+		{"SELECT pg_advisory_lock($1)", "SELECT", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		operation, table := operationName(c.query)
+		if operation != c.operation || table != c.table {
+			t.Errorf("operationName(%q) = %q, %q, want %q, %q", c.query, operation, table, c.operation, c.table)
+		}
+	}
+}
+
+func TestMiddlewareTagsEntities(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	r := mux.NewRouter()
+	r.Use(Middleware())
+	r.HandleFunc("/api/bids/{bidId}/status", func(w http.ResponseWriter, r *http.Request) {})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/bids/42/status?username=user1", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans, want 1", len(spans))
+	}
+	if spans[0].Name() != "/api/bids/{bidId}/status" {
+		t.Errorf("span name %q", spans[0].Name())
+	}
+	attributes := map[string]string{}
+	for _, attribute := range spans[0].Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	if attributes["bid.id"] != "42" || attributes["enduser.id"] != "user1" {
+		t.Errorf("attributes = %v", attributes)
+	}
+}